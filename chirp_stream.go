@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chirpStreamReplay is how many chirps are kept for clients resuming with
+// Last-Event-ID. Older chirps have to be fetched from GET /api/chirps.
+const chirpStreamReplay = 1024
+
+// chirpStreamBuffer is how many chirps a subscriber may fall behind before
+// it is dropped. Clients reconnect and resume from their last event.
+const chirpStreamBuffer = 64
+
+var errInvalidEventID = errors.New("invalid event id")
+
+// chirpEventID identifies a chirp by its creation time and id. Every
+// instance gets the same chirps from the event bus, so the ids are the same
+// on all of them and a client can resume on any instance.
+type chirpEventID struct {
+	CreatedAt time.Time
+	ChirpID   uuid.UUID
+}
+
+func (id chirpEventID) String() string {
+	return fmt.Sprintf("%d_%s", id.CreatedAt.UnixNano(), id.ChirpID)
+}
+
+// after orders ids by creation time, then chirp id for chirps created at
+// the same time.
+func (id chirpEventID) after(other chirpEventID) bool {
+	if !id.CreatedAt.Equal(other.CreatedAt) {
+		return id.CreatedAt.After(other.CreatedAt)
+	}
+	return strings.Compare(id.ChirpID.String(), other.ChirpID.String()) > 0
+}
+
+func parseChirpEventID(s string) (chirpEventID, error) {
+	nanos, chirpID, ok := strings.Cut(s, "_")
+	if !ok {
+		return chirpEventID{}, errInvalidEventID
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return chirpEventID{}, errInvalidEventID
+	}
+	id, err := uuid.Parse(chirpID)
+	if err != nil {
+		return chirpEventID{}, errInvalidEventID
+	}
+	return chirpEventID{CreatedAt: time.Unix(0, n), ChirpID: id}, nil
+}
+
+type chirpEvent struct {
+	ID    chirpEventID
+	Chirp Chirp
+}
+
+type chirpSubscriber struct {
+	events chan chirpEvent
+}
+
+// chirpStream fans out newly created chirps to the open SSE streams and
+// keeps the most recent ones, ordered by id, for replay.
+type chirpStream struct {
+	mu          sync.Mutex
+	replay      []chirpEvent
+	subscribers map[*chirpSubscriber]struct{}
+}
+
+func newChirpStream() *chirpStream {
+	return &chirpStream{
+		replay:      make([]chirpEvent, 0, chirpStreamReplay),
+		subscribers: map[*chirpSubscriber]struct{}{},
+	}
+}
+
+func (s *chirpStream) Publish(chirp Chirp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := chirpEvent{ID: chirpEventID{CreatedAt: chirp.CreatedAt, ChirpID: chirp.ID}, Chirp: chirp}
+
+	// Chirps from other instances may come a little out of order.
+	i := sort.Search(len(s.replay), func(i int) bool { return s.replay[i].ID.after(event.ID) })
+	s.replay = slices.Insert(s.replay, i, event)
+	if len(s.replay) > chirpStreamReplay {
+		copy(s.replay, s.replay[1:])
+		s.replay = s.replay[:len(s.replay)-1]
+	}
+
+	for sub := range s.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			// Too slow, the client resumes from its last event on reconnect.
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber and returns the buffered chirps
+// after lastID, so nothing is lost or repeated between the replay and the
+// live events. A nil lastID replays nothing.
+func (s *chirpStream) Subscribe(lastID *chirpEventID) (*chirpSubscriber, []chirpEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	missed := []chirpEvent{}
+	if lastID != nil {
+		for _, event := range s.replay {
+			if event.ID.after(*lastID) {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	sub := &chirpSubscriber{events: make(chan chirpEvent, chirpStreamBuffer)}
+	s.subscribers[sub] = struct{}{}
+	return sub, missed
+}
+
+func (s *chirpStream) Unsubscribe(sub *chirpSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[sub]; ok {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
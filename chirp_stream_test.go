@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func testChirp(createdAt time.Time) Chirp {
+	return Chirp{ID: uuid.New(), CreatedAt: createdAt, UserID: uuid.New(), Body: "hi"}
+}
+
+func TestChirpEventIDRoundTrip(t *testing.T) {
+	id := chirpEventID{CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC), ChirpID: uuid.New()}
+	got, err := parseChirpEventID(id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(id.CreatedAt) || got.ChirpID != id.ChirpID {
+		t.Fatalf("parsed %v, want %v", got, id)
+	}
+	for _, bad := range []string{"", "12", "abc_" + uuid.NewString(), "12_nope"} {
+		if _, err := parseChirpEventID(bad); err == nil {
+			t.Errorf("parseChirpEventID(%q) succeeded", bad)
+		}
+	}
+}
+
+// Instances get the chirps of the bus in different orders, a client must
+// resume on any of them from where it left off.
+func TestChirpStreamResumeOnOtherInstance(t *testing.T) {
+	now := time.Now().UTC()
+	chirps := []Chirp{testChirp(now), testChirp(now.Add(time.Millisecond)), testChirp(now.Add(2 * time.Millisecond))}
+
+	second := newChirpStream()
+	for _, i := range []int{1, 0, 2} {
+		second.Publish(chirps[i])
+	}
+
+	// The client saw the first chirp on the first instance.
+	lastID := chirpEventID{CreatedAt: chirps[0].CreatedAt, ChirpID: chirps[0].ID}
+	resumed, missed := second.Subscribe(&lastID)
+	defer second.Unsubscribe(resumed)
+	if len(missed) != 2 || missed[0].Chirp.ID != chirps[1].ID || missed[1].Chirp.ID != chirps[2].ID {
+		t.Fatalf("missed = %+v, want chirps 1 and 2 in order", missed)
+	}
+}
+
+func TestChirpStreamReplayIsBounded(t *testing.T) {
+	s := newChirpStream()
+	start := time.Now().UTC()
+	for i := 0; i < chirpStreamReplay+10; i++ {
+		s.Publish(testChirp(start.Add(time.Duration(i) * time.Millisecond)))
+	}
+	// A chirp older than everything kept is not kept either.
+	s.Publish(testChirp(start.Add(-time.Hour)))
+
+	lastID := chirpEventID{CreatedAt: start.Add(-2 * time.Hour)}
+	sub, missed := s.Subscribe(&lastID)
+	defer s.Unsubscribe(sub)
+	if len(missed) != chirpStreamReplay {
+		t.Fatalf("replayed %d chirps, want %d", len(missed), chirpStreamReplay)
+	}
+	if !missed[0].Chirp.CreatedAt.Equal(start.Add(10 * time.Millisecond)) {
+		t.Errorf("oldest replayed chirp from %v", missed[0].Chirp.CreatedAt)
+	}
+	for i := 1; i < len(missed); i++ {
+		if !missed[i].ID.after(missed[i-1].ID) {
+			t.Fatalf("replay out of order at %d", i)
+		}
+	}
+}
+
+func TestChirpStreamNoReplayWithoutLastID(t *testing.T) {
+	s := newChirpStream()
+	s.Publish(testChirp(time.Now()))
+	sub, missed := s.Subscribe(nil)
+	defer s.Unsubscribe(sub)
+	if len(missed) != 0 {
+		t.Fatalf("replayed %d chirps", len(missed))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+// createAdmin promotes the user with the given email to admin, creating it
+// with the password in ADMIN_PASSWORD if it does not exist yet. It is run
+// as `goserver create-admin -email <email>` to bootstrap the first admin.
+func createAdmin(db *database.Queries, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := fs.String("email", "", "email of the user to promote")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("create-admin: -email is required")
+	}
+
+	ctx := context.Background()
+	user, err := db.GetUser(ctx, *email)
+	if errors.Is(err, sql.ErrNoRows) {
+		password := os.Getenv("ADMIN_PASSWORD")
+		if password == "" {
+			return errors.New("create-admin: user does not exist and ADMIN_PASSWORD is not set")
+		}
+		hashedPassword, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user, err = db.CreateUser(ctx, database.CreateUserParams{
+			Email:          *email,
+			HashedPassword: hashedPassword,
+			Username:       generatedUsername(),
+		})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if _, err = db.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: roleAdmin}); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now an admin.\n", user.Email)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/MeMetoCoco3/goserver/internal/events"
+	"github.com/google/uuid"
+)
+
+const (
+	eventBusLocal    = "local"
+	eventBusPostgres = "postgres"
+)
+
+const eventsChannel = "goserver_events"
+
+const (
+	eventChirpCreated        = "chirp.created"
+	eventNotificationCreated = "notification.created"
+	eventUserBlocked         = "user.blocked"
+	eventUserUnblocked       = "user.unblocked"
+	eventUserMuted           = "user.muted"
+	eventUserUnmuted         = "user.unmuted"
+)
+
+type notificationEvent struct {
+	UserID       uuid.UUID    `json:"user_id"`
+	Notification Notification `json:"notification"`
+}
+
+// userRelationEvent is the payload of the user events: UserID blocked,
+// unblocked, muted or unmuted TargetID.
+type userRelationEvent struct {
+	UserID   uuid.UUID `json:"user_id"`
+	TargetID uuid.UUID `json:"target_id"`
+}
+
+// newEventBus returns the bus selected by EVENT_BUS. Deployments running
+// more than one instance need the postgres bus, so real-time listeners on
+// every instance see events created on any of them.
+func newEventBus(mode string, db *sql.DB, dbURL string) (events.Bus, error) {
+	switch mode {
+	case eventBusLocal, "":
+		return events.NewLocal(), nil
+	case eventBusPostgres:
+		return events.NewPostgres(db, dbURL, eventsChannel)
+	default:
+		return nil, fmt.Errorf("unknown event bus %q", mode)
+	}
+}
+
+func publishEvent(ctx context.Context, bus events.Bus, typ string, data any) {
+	event, err := events.NewEvent(typ, data)
+	if err == nil {
+		err = bus.Publish(ctx, event)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event: %v", typ, err)
+	}
+}
+
+// handleEvent forwards events from the bus to the real-time listeners of
+// this instance.
+func (cfg *apiConfig) handleEvent(event events.Event) {
+	switch event.Type {
+	case eventChirpCreated:
+		chirp := Chirp{}
+		if err := json.Unmarshal(event.Data, &chirp); err != nil {
+			log.Printf("Failed to decode %s event: %v", event.Type, err)
+			return
+		}
+		cfg.chirpStream.Publish(chirp)
+		cfg.gateway.PublishChirp(chirp)
+	case eventNotificationCreated:
+		n := notificationEvent{}
+		if err := json.Unmarshal(event.Data, &n); err != nil {
+			log.Printf("Failed to decode %s event: %v", event.Type, err)
+			return
+		}
+		cfg.gateway.PublishNotification(n.UserID, n.Notification)
+	case eventUserBlocked, eventUserUnblocked, eventUserMuted, eventUserUnmuted:
+		e := userRelationEvent{}
+		if err := json.Unmarshal(event.Data, &e); err != nil {
+			log.Printf("Failed to decode %s event: %v", event.Type, err)
+			return
+		}
+		// Blocks hide both users from each other, mutes only the target
+		// from the user.
+		if event.Type == eventUserBlocked || event.Type == eventUserUnblocked {
+			cfg.gateway.RefreshHidden(e.UserID, e.TargetID)
+		} else {
+			cfg.gateway.RefreshHidden(e.UserID)
+		}
+	}
+}
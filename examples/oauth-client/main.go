@@ -0,0 +1,160 @@
+// Command oauth-client is a minimal third party app walking through the
+// Chirpy authorization code flow with PKCE.
+//
+// Register it first with a first party access token:
+//
+//	curl -X POST localhost:8080/api/oauth/clients \
+//		-H "Authorization: Bearer $TOKEN" \
+//		-d '{"name":"Example","redirect_uris":["http://127.0.0.1:9000/callback"]}'
+//
+// then run it with the returned client_id and open the printed URL:
+//
+//	go run ./examples/oauth-client -client-id <client_id>
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "Chirpy server")
+	clientID := flag.String("client-id", "", "client ID")
+	clientSecret := flag.String("client-secret", "", "client secret, for confidential clients")
+	listen := flag.String("listen", "127.0.0.1:9000", "address of the redirect URI")
+	scope := flag.String("scope", "chirps:read profile", "scopes to ask for")
+	revoke := flag.Bool("revoke", false, "revoke the token once used")
+	flag.Parse()
+	if *clientID == "" {
+		log.Fatal("-client-id is required")
+	}
+
+	redirectURI := "http://" + *listen + "/callback"
+	verifier := randomString()
+	challenge := sha256.Sum256([]byte(verifier))
+	state := randomString()
+
+	authorizeURL := *server + "/oauth/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {*clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {*scope},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+	fmt.Printf("Open this URL in a browser:\n\n%s\n\n", authorizeURL)
+
+	done := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /callback", func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			log.Print("State mismatch, ignoring the callback")
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			fmt.Fprintf(w, "Authorization failed: %s", e)
+			log.Printf("Authorization failed: %s: %s", e, q.Get("error_description"))
+			return
+		}
+
+		token, err := exchange(*server, *clientID, *clientSecret, q.Get("code"), redirectURI, verifier)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			log.Print(err)
+			return
+		}
+		fmt.Fprintln(w, "Authorized, you can close this tab.")
+		log.Printf("Got a token for %q", token.Scope)
+
+		for _, path := range []string{"/api/users/me", "/api/chirps", "/api/users/me/suggestions"} {
+			status, body := call(*server+path, token.AccessToken)
+			log.Printf("GET %s: %d %s", path, status, strings.TrimSpace(body))
+		}
+
+		if *revoke {
+			form := url.Values{"token": {token.AccessToken}, "client_id": {*clientID}, "client_secret": {*clientSecret}}
+			res, err := http.PostForm(*server+"/oauth/revoke", form)
+			if err != nil {
+				log.Print(err)
+				return
+			}
+			res.Body.Close()
+			status, _ := call(*server+"/api/users/me", token.AccessToken)
+			log.Printf("Revoked: %d, GET /api/users/me now answers %d", res.StatusCode, status)
+		}
+	})
+
+	srv := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		<-done
+		srv.Shutdown(context.Background())
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func exchange(server, clientID, clientSecret, code, redirectURI, verifier string) (tokenResponse, error) {
+	res, err := http.PostForm(server+"/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	defer res.Body.Close()
+
+	token := tokenResponse{}
+	if err = json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return tokenResponse{}, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return tokenResponse{}, fmt.Errorf("token request failed: %s: %s", token.Error, token.Description)
+	}
+	return token, nil
+}
+
+func call(u, token string) (int, string) {
+	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return res.StatusCode, string(body)
+}
+
+func randomString() string {
+	buff := make([]byte, 32)
+	if _, err := rand.Read(buff); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buff)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+// fakeResult is what a fake database answers to one query.
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+// fakeQuery answers the query called name, the sqlc name of the query,
+// made with args.
+type fakeQuery func(name string, args []driver.Value) (fakeResult, error)
+
+var (
+	fakeDBs   sync.Map
+	fakeDBSeq atomic.Int64
+)
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+// newFakeDB returns a database answering every query with handle, so
+// handlers can be tested without Postgres.
+func newFakeDB(t *testing.T, handle fakeQuery) *sql.DB {
+	t.Helper()
+	dsn := fmt.Sprint(fakeDBSeq.Add(1))
+	fakeDBs.Store(dsn, handle)
+	db, err := sql.Open("fake", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDBs.Delete(dsn)
+	})
+	return db
+}
+
+// newTestConfig returns a config on a fake database answering with handle.
+func newTestConfig(t *testing.T, handle fakeQuery) *apiConfig {
+	t.Helper()
+	db := newFakeDB(t, handle)
+	keys, err := auth.NewKeyring(auth.Key{}, nil, "test secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{db: database.New(db), dbConn: db, keys: keys}
+}
+
+// authorizedRequest returns a request carrying an access token of userID.
+func authorizedRequest(t *testing.T, cfg *apiConfig, method, target string, userID uuid.UUID) *http.Request {
+	t.Helper()
+	token, err := cfg.keys.MakeJWT(userID, roleUser, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(method, target, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	handle, ok := fakeDBs.Load(dsn)
+	if !ok {
+		return nil, errors.New("unknown fake database")
+	}
+	return &fakeConn{handle: handle.(fakeQuery)}, nil
+}
+
+type fakeConn struct {
+	handle fakeQuery
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	name := ""
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(query), "-- name: "); ok {
+		name, _, _ = strings.Cut(rest, " ")
+	}
+	return &fakeStmt{conn: c, name: name}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	conn *fakeConn
+	name string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.conn.handle(s.name, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(res.affected), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	res, err := s.conn.handle(s.name, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{result: res}, nil
+}
+
+type fakeRows struct {
+	result fakeResult
+	next   int
+}
+
+func (r *fakeRows) Columns() []string { return r.result.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
+
+// userResult answers a query returning users with users.
+func userResult(users ...database.User) fakeResult {
+	res := fakeResult{columns: []string{
+		"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red",
+		"display_name", "bio", "avatar_url", "location", "website", "username",
+		"username_changed_at", "role", "email_verified_at",
+	}}
+	for _, u := range users {
+		var usernameChangedAt, emailVerifiedAt driver.Value
+		if u.UsernameChangedAt.Valid {
+			usernameChangedAt = u.UsernameChangedAt.Time
+		}
+		if u.EmailVerifiedAt.Valid {
+			emailVerifiedAt = u.EmailVerifiedAt.Time
+		}
+		res.rows = append(res.rows, []driver.Value{
+			u.ID.String(), u.CreatedAt, u.UpdatedAt, u.Email, u.HashedPassword, u.IsChirpyRed,
+			u.DisplayName, u.Bio, u.AvatarUrl, u.Location, u.Website, u.Username,
+			usernameChangedAt, u.Role, emailVerifiedAt,
+		})
+	}
+	return res
+}
+
+// attemptFailureResult answers LockAttemptFailure and RecordAttemptFailure.
+func attemptFailureResult(args []driver.Value, failures int64, lastFailureAt time.Time) fakeResult {
+	return fakeResult{
+		columns: []string{"kind", "key", "failures", "last_failure_at"},
+		rows:    [][]driver.Value{{args[0], args[1], failures, lastFailureAt}},
+	}
+}
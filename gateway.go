@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/websocket"
+	"github.com/google/uuid"
+)
+
+// wsSendBuffer is how many frames a connection may fall behind before it is
+// dropped as a slow consumer.
+const wsSendBuffer = 64
+const wsWriteTimeout = 10 * time.Second
+const wsPingInterval = 30 * time.Second
+const wsReadTimeout = 2 * wsPingInterval
+
+// Connections whose access token expired stop receiving events and are
+// closed unless they send a new token within wsReauthGrace.
+const wsReauthGrace = 30 * time.Second
+const wsExpiryCheckInterval = 5 * time.Second
+
+const (
+	wsChannelTimeline      = "timeline"
+	wsChannelNotifications = "notifications"
+	wsChannelRepliesPrefix = "replies:"
+)
+
+// wsGateway tracks the open WebSocket connections and routes events to
+// those subscribed to them.
+type wsGateway struct {
+	db *database.Queries
+
+	mu      sync.RWMutex
+	clients map[*wsClient]struct{}
+}
+
+func newGateway(db *database.Queries) *wsGateway {
+	return &wsGateway{
+		db:      db,
+		clients: map[*wsClient]struct{}{},
+	}
+}
+
+func (g *wsGateway) register(c *wsClient) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clients[c] = struct{}{}
+}
+
+func (g *wsGateway) unregister(c *wsClient) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.clients, c)
+}
+
+func (g *wsGateway) subscribers(channel string) []*wsClient {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	subs := []*wsClient{}
+	for c := range g.clients {
+		if c.subscribed(channel) {
+			subs = append(subs, c)
+		}
+	}
+	return subs
+}
+
+// PublishChirp sends chirp to the timelines of its author and followers,
+// and to the reply subscribers of the chirp it answers.
+func (g *wsGateway) PublishChirp(chirp Chirp) {
+	go g.deliverChirp(context.Background(), chirp)
+}
+
+func (g *wsGateway) deliverChirp(ctx context.Context, chirp Chirp) {
+	subs := g.subscribers(wsChannelTimeline)
+	if len(subs) > 0 {
+		ids := make([]uuid.UUID, 0, len(subs))
+		for _, c := range subs {
+			ids = append(ids, c.user())
+		}
+		followers, err := g.db.GetFollowersAmong(ctx, database.GetFollowersAmongParams{
+			UserID: chirp.UserID,
+			Ids:    ids,
+		})
+		if err != nil {
+			log.Printf("Failed to route chirp %s to timelines: %v", chirp.ID, err)
+		}
+		recipients := userSet{chirp.UserID: struct{}{}}
+		for _, id := range followers {
+			recipients[id] = struct{}{}
+		}
+		for _, c := range subs {
+			if recipients.has(c.user()) {
+				c.event(wsChannelTimeline, "chirp", chirp.UserID, chirp)
+			}
+		}
+	}
+
+	if chirp.ReplyToID != nil {
+		channel := wsChannelRepliesPrefix + chirp.ReplyToID.String()
+		for _, c := range g.subscribers(channel) {
+			c.event(channel, "chirp", chirp.UserID, chirp)
+		}
+	}
+}
+
+// PublishNotification sends notification to the connections of userID.
+func (g *wsGateway) PublishNotification(userID uuid.UUID, notification Notification) {
+	actorID := uuid.Nil
+	if notification.ActorID != nil {
+		actorID = *notification.ActorID
+	}
+	for _, c := range g.subscribers(wsChannelNotifications) {
+		if c.user() == userID {
+			c.event(wsChannelNotifications, "notification", actorID, notification)
+		}
+	}
+}
+
+// RefreshHidden reloads the hidden users of the connections of userIDs,
+// after they blocked or muted someone or were blocked.
+func (g *wsGateway) RefreshHidden(userIDs ...uuid.UUID) {
+	users := userSet{}
+	for _, id := range userIDs {
+		users[id] = struct{}{}
+	}
+
+	g.mu.RLock()
+	clients := []*wsClient{}
+	for c := range g.clients {
+		if users.has(c.user()) {
+			clients = append(clients, c)
+		}
+	}
+	g.mu.RUnlock()
+
+	for _, c := range clients {
+		go func(c *wsClient) {
+			if err := c.refreshHidden(context.Background()); err != nil {
+				log.Printf("Failed to refresh hidden users of %s: %v", c.user(), err)
+			}
+		}(c)
+	}
+}
+
+func (g *wsGateway) hiddenUsers(ctx context.Context, userID uuid.UUID) (userSet, error) {
+	hidden := userSet{}
+	ids, err := g.db.GetHiddenUserIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hidden[id] = struct{}{}
+	}
+	return hidden, nil
+}
+
+type wsMessage struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+type wsEvent struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Event   string `json:"event"`
+	Data    any    `json:"data"`
+}
+
+type wsControl struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// wsClient is one open connection. Frames are queued on send and written
+// by writeLoop, so a slow client never blocks publishers.
+type wsClient struct {
+	gateway *wsGateway
+	conn    *websocket.Conn
+	send    chan []byte
+	done    chan struct{}
+	once    sync.Once
+
+	mu        sync.Mutex
+	userID    uuid.UUID
+	expiresAt time.Time
+	expired   bool
+	hidden    userSet
+	channels  map[string]struct{}
+}
+
+func (c *wsClient) user() uuid.UUID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.userID
+}
+
+func (c *wsClient) subscribed(channel string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.channels[channel]
+	return ok
+}
+
+// event queues an event on channel unless the client hides actorID or its
+// token expired.
+func (c *wsClient) event(channel, kind string, actorID uuid.UUID, data any) {
+	c.mu.Lock()
+	skip := c.expired || c.hidden.has(actorID)
+	c.mu.Unlock()
+	if skip {
+		return
+	}
+	c.sendJSON(wsEvent{Type: "event", Channel: channel, Event: kind, Data: data})
+}
+
+func (c *wsClient) sendJSON(v any) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode websocket message: %v", err)
+		return
+	}
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	select {
+	case c.send <- msg:
+	default:
+		go c.close(websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
+func (c *wsClient) close(code int, reason string) {
+	c.once.Do(func() {
+		close(c.done)
+		c.gateway.unregister(c)
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		c.conn.WriteClose(code, reason)
+		c.conn.Close()
+	})
+}
+
+func (c *wsClient) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	expiry := time.NewTicker(wsExpiryCheckInterval)
+	defer expiry.Stop()
+
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = c.conn.WriteMessage(websocket.OpText, msg)
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = c.conn.WriteMessage(websocket.OpPing, nil)
+		case <-expiry.C:
+			c.checkExpiry()
+		}
+		if err != nil {
+			c.close(websocket.CloseGoingAway, "write failed")
+			return
+		}
+	}
+}
+
+func (c *wsClient) checkExpiry() {
+	now := time.Now()
+	c.mu.Lock()
+	expiresAt := c.expiresAt
+	notify := !c.expired && now.After(expiresAt)
+	if notify {
+		c.expired = true
+	}
+	c.mu.Unlock()
+
+	if now.After(expiresAt.Add(wsReauthGrace)) {
+		c.close(websocket.ClosePolicyViolation, "token expired")
+		return
+	}
+	if notify {
+		c.sendJSON(wsControl{Type: "reauth_required"})
+	}
+}
+
+// authenticate replaces the token of the connection. The token must belong
+// to the user the connection was opened by.
+func (c *wsClient) authenticate(ctx context.Context, userID uuid.UUID, expiresAt time.Time) error {
+	hidden, err := c.gateway.hiddenUsers(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.userID = userID
+	c.expiresAt = expiresAt
+	c.expired = false
+	c.hidden = hidden
+	return nil
+}
+
+func (c *wsClient) refreshHidden(ctx context.Context) error {
+	hidden, err := c.gateway.hiddenUsers(ctx, c.user())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hidden = hidden
+	return nil
+}
+
+func (c *wsClient) subscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels[channel] = struct{}{}
+}
+
+func (c *wsClient) unsubscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.channels, channel)
+}
+
+func isRepliesChannel(channel string) bool {
+	return strings.HasPrefix(channel, wsChannelRepliesPrefix)
+}
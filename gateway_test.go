@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/websocket"
+	"github.com/google/uuid"
+)
+
+// newTestGateway returns a gateway on a fake database where follows holds
+// the followers of each user and hidden the hidden users of each user.
+func newTestGateway(t *testing.T, follows, hidden map[uuid.UUID][]uuid.UUID) *wsGateway {
+	t.Helper()
+	db := newFakeDB(t, func(name string, args []driver.Value) (fakeResult, error) {
+		var ids []uuid.UUID
+		switch name {
+		case "GetFollowersAmong":
+			ids = follows[uuid.MustParse(args[0].(string))]
+		case "GetHiddenUserIDs":
+			ids = hidden[uuid.MustParse(args[0].(string))]
+		default:
+			t.Errorf("unexpected query %s", name)
+		}
+		res := fakeResult{columns: []string{"user_id"}}
+		for _, id := range ids {
+			res.rows = append(res.rows, []driver.Value{id.String()})
+		}
+		return res, nil
+	})
+	return newGateway(database.New(db))
+}
+
+// newTestClient registers a connection of userID, valid for validFor, on
+// g. Its frames are queued on send but never written, the test reads them
+// from there. peer is the other end of the connection.
+func newTestClient(t *testing.T, g *wsGateway, userID uuid.UUID, validFor time.Duration, channels ...string) (c *wsClient, peer net.Conn) {
+	t.Helper()
+	server, peer := net.Pipe()
+	t.Cleanup(func() { peer.Close() })
+	c = &wsClient{
+		gateway:  g,
+		conn:     websocket.NewConn(server, bufio.NewReader(server)),
+		send:     make(chan []byte, wsSendBuffer),
+		done:     make(chan struct{}),
+		channels: map[string]struct{}{},
+	}
+	if err := c.authenticate(context.Background(), userID, time.Now().Add(validFor)); err != nil {
+		t.Fatal(err)
+	}
+	for _, channel := range channels {
+		c.subscribe(channel)
+	}
+	g.register(c)
+	return c, peer
+}
+
+// received decodes the frames queued on c.
+func received(t *testing.T, c *wsClient) []map[string]any {
+	t.Helper()
+	msgs := []map[string]any{}
+	for {
+		select {
+		case frame := <-c.send:
+			msg := map[string]any{}
+			if err := json.Unmarshal(frame, &msg); err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestGatewayRoutesChirps(t *testing.T) {
+	author, follower, stranger, blocker := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	g := newTestGateway(t,
+		map[uuid.UUID][]uuid.UUID{author: {follower, blocker}},
+		map[uuid.UUID][]uuid.UUID{blocker: {author}},
+	)
+	authorConn, _ := newTestClient(t, g, author, time.Hour, wsChannelTimeline)
+	followerConn, _ := newTestClient(t, g, follower, time.Hour, wsChannelTimeline)
+	strangerConn, _ := newTestClient(t, g, stranger, time.Hour, wsChannelTimeline)
+	blockerConn, _ := newTestClient(t, g, blocker, time.Hour, wsChannelTimeline)
+
+	parentID := uuid.New()
+	repliesConn, _ := newTestClient(t, g, stranger, time.Hour, wsChannelRepliesPrefix+parentID.String())
+
+	chirp := Chirp{ID: uuid.New(), UserID: author, Body: "hello", ReplyToID: &parentID}
+	g.deliverChirp(context.Background(), chirp)
+
+	for name, tt := range map[string]struct {
+		conn    *wsClient
+		channel string
+	}{
+		"author":             {authorConn, wsChannelTimeline},
+		"follower":           {followerConn, wsChannelTimeline},
+		"replies subscriber": {repliesConn, wsChannelRepliesPrefix + parentID.String()},
+	} {
+		msgs := received(t, tt.conn)
+		if len(msgs) != 1 || msgs[0]["channel"] != tt.channel || msgs[0]["event"] != "chirp" {
+			t.Errorf("%s got %v", name, msgs)
+		}
+	}
+	if msgs := received(t, strangerConn); len(msgs) != 0 {
+		t.Errorf("stranger got %v", msgs)
+	}
+	if msgs := received(t, blockerConn); len(msgs) != 0 {
+		t.Errorf("user hiding the author got %v", msgs)
+	}
+}
+
+func TestGatewayRoutesNotifications(t *testing.T) {
+	userID, otherID := uuid.New(), uuid.New()
+	g := newTestGateway(t, nil, nil)
+	userConn, _ := newTestClient(t, g, userID, time.Hour, wsChannelNotifications)
+	otherConn, _ := newTestClient(t, g, otherID, time.Hour, wsChannelNotifications)
+	unsubscribed, _ := newTestClient(t, g, userID, time.Hour)
+
+	g.PublishNotification(userID, Notification{ID: uuid.New(), Kind: "follow"})
+
+	if msgs := received(t, userConn); len(msgs) != 1 || msgs[0]["event"] != "notification" {
+		t.Errorf("user got %v", msgs)
+	}
+	if msgs := received(t, otherConn); len(msgs) != 0 {
+		t.Errorf("other user got %v", msgs)
+	}
+	if msgs := received(t, unsubscribed); len(msgs) != 0 {
+		t.Errorf("unsubscribed connection got %v", msgs)
+	}
+}
+
+func TestGatewayDropsSlowConsumers(t *testing.T) {
+	userID := uuid.New()
+	g := newTestGateway(t, nil, nil)
+	c, peer := newTestClient(t, g, userID, time.Hour, wsChannelNotifications)
+
+	closeFrame := make(chan []byte, 1)
+	go func() {
+		frame := make([]byte, 4)
+		io.ReadFull(peer, frame)
+		closeFrame <- frame
+		io.Copy(io.Discard, peer)
+	}()
+
+	for i := 0; i <= wsSendBuffer; i++ {
+		g.PublishNotification(userID, Notification{ID: uuid.New(), Kind: "follow"})
+	}
+
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow consumer was not dropped")
+	}
+	frame := <-closeFrame
+	if frame[0] != 0x80|websocket.OpClose || binary.BigEndian.Uint16(frame[2:]) != websocket.CloseTryAgainLater {
+		t.Errorf("close frame %x", frame)
+	}
+	if subs := g.subscribers(wsChannelNotifications); len(subs) != 0 {
+		t.Errorf("dropped connection still subscribed")
+	}
+}
+
+func TestGatewayReauthentication(t *testing.T) {
+	userID := uuid.New()
+	g := newTestGateway(t, nil, nil)
+	c, _ := newTestClient(t, g, userID, -time.Second, wsChannelNotifications)
+
+	c.checkExpiry()
+	msgs := received(t, c)
+	if len(msgs) != 1 || msgs[0]["type"] != "reauth_required" {
+		t.Fatalf("got %v, want reauth_required", msgs)
+	}
+
+	// Events stop until a new token comes.
+	g.PublishNotification(userID, Notification{ID: uuid.New(), Kind: "follow"})
+	if msgs := received(t, c); len(msgs) != 0 {
+		t.Fatalf("expired connection got %v", msgs)
+	}
+
+	if err := c.authenticate(context.Background(), userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	c.checkExpiry()
+	g.PublishNotification(userID, Notification{ID: uuid.New(), Kind: "follow"})
+	if msgs := received(t, c); len(msgs) != 1 || msgs[0]["event"] != "notification" {
+		t.Fatalf("reauthenticated connection got %v", msgs)
+	}
+}
+
+func TestGatewayClosesAfterReauthGrace(t *testing.T) {
+	g := newTestGateway(t, nil, nil)
+	c, peer := newTestClient(t, g, uuid.New(), -wsReauthGrace-time.Second)
+	go io.Copy(io.Discard, peer)
+
+	c.checkExpiry()
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection with an expired token stayed open")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handleBlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	targetID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+	if targetID == userID {
+		http.Error(w, `{"error":"Users can not block themselves."}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err = cfg.db.GetUserWithID(r.Context(), targetID); err != nil {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	err = cfg.db.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// A block breaks the follow relationship in both directions.
+	for _, pair := range [][2]uuid.UUID{{userID, targetID}, {targetID, userID}} {
+		err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+			FollowerID: pair[0],
+			FolloweeID: pair[1],
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		if err = cfg.timeline.Unfollow(r.Context(), pair[0], pair[1]); err != nil {
+			log.Printf("Failed to clean timeline of %s: %v", pair[0], err)
+		}
+	}
+
+	publishEvent(r.Context(), cfg.events, eventUserBlocked, userRelationEvent{UserID: userID, TargetID: targetID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleUnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	targetID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	publishEvent(r.Context(), cfg.events, eventUserUnblocked, userRelationEvent{UserID: userID, TargetID: targetID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleMuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	targetID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+	if targetID == userID {
+		http.Error(w, `{"error":"Users can not mute themselves."}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err = cfg.db.GetUserWithID(r.Context(), targetID); err != nil {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	err = cfg.db.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	publishEvent(r.Context(), cfg.events, eventUserMuted, userRelationEvent{UserID: userID, TargetID: targetID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleUnmuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	targetID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	publishEvent(r.Context(), cfg.events, eventUserUnmuted, userRelationEvent{UserID: userID, TargetID: targetID})
+	w.WriteHeader(http.StatusNoContent)
+}
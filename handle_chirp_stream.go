@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const chirpStreamHeartbeat = 15 * time.Second
+
+func (cfg *apiConfig) handleChirpStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error":"Streaming not supported."}`, http.StatusInternalServerError)
+		return
+	}
+
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// author_id takes either a user id or a handle.
+	authorID := uuid.Nil
+	if author := r.URL.Query().Get("author_id"); author != "" {
+		authorID, err = uuid.Parse(author)
+		if err != nil {
+			user, _, err := cfg.userByHandle(r.Context(), parseHandle(author))
+			if err != nil {
+				http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+				return
+			}
+			authorID = user.ID
+		}
+	}
+	hashtag := normalizeTrendTerm(r.URL.Query().Get("hashtag"))
+
+	// Browsers resend the Last-Event-ID header on reconnect, other clients
+	// may pass last_event_id on the query instead.
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID *chirpEventID
+	if lastEventID != "" {
+		// Numbered ids, from before the instances shared ids, tell
+		// nothing: those clients start over with live events.
+		id, err := parseChirpEventID(lastEventID)
+		if err == nil {
+			lastID = &id
+		} else if _, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			http.Error(w, `{"error":"Not correct Last-Event-ID."}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	matches := func(chirp Chirp) bool {
+		if hidden.has(chirp.UserID) {
+			return false
+		}
+		if authorID != uuid.Nil && chirp.UserID != authorID {
+			return false
+		}
+		if hashtag != "" {
+			for _, tag := range extractHashtags(chirp.Body) {
+				if tag == hashtag {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	}
+
+	sub, missed := cfg.chirpStream.Subscribe(lastID)
+	defer cfg.chirpStream.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event chirpEvent) error {
+		if !matches(event.Chirp) {
+			return nil
+		}
+		data, err := json.Marshal(event.Chirp)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %s\nevent: chirp\ndata: %s\n\n", event.ID, data)
+		return err
+	}
+
+	for _, event := range missed {
+		if err = send(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(chirpStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if err = send(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/MeMetoCoco3/goserver/internal/auth"
 	"github.com/MeMetoCoco3/goserver/internal/database"
 	"github.com/google/uuid"
+	"log"
 	"net/http"
 	"strings"
 )
@@ -16,8 +19,18 @@ func (cfg *apiConfig) handleGetChirps(w http.ResponseWriter, r *http.Request) {
 	authorID := r.URL.Query().Get("author_id")
 	orderBy := r.URL.Query().Get("sort")
 
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
 	if authorID == "" {
-		var err error
 		if orderBy == "asc" || orderBy == "" {
 			newChirps, err = cfg.db.GetChirps(r.Context())
 		} else if orderBy == "desc" {
@@ -32,20 +45,22 @@ func (cfg *apiConfig) handleGetChirps(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		for _, chirp := range newChirps {
-			chirps = append(chirps, Chirp{
-				ID:        chirp.ID,
-				CreatedAt: chirp.CreatedAt,
-				UpdatedAt: chirp.UpdatedAt,
-				Body:      chirp.Body,
-				UserID:    chirp.UserID,
-			})
+			if hidden.has(chirp.UserID) {
+				continue
+			}
+			chirps = append(chirps, chirpFromDB(chirp))
 		}
 
 	} else {
+		// author_id takes either a user id or a handle.
 		authorUUID, err := uuid.Parse(authorID)
 		if err != nil {
-			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
-			return
+			author, _, err := cfg.userByHandle(r.Context(), parseHandle(authorID))
+			if err != nil {
+				http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+				return
+			}
+			authorUUID = author.ID
 		}
 		if orderBy == "asc" || orderBy == "" {
 			newChirps, err = cfg.db.GetChirpByAuthor(r.Context(), authorUUID)
@@ -59,14 +74,10 @@ func (cfg *apiConfig) handleGetChirps(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 			return
 		}
-		for _, chirp := range newChirps {
-			chirps = append(chirps, Chirp{
-				ID:        chirp.ID,
-				CreatedAt: chirp.CreatedAt,
-				UpdatedAt: chirp.UpdatedAt,
-				Body:      chirp.Body,
-				UserID:    chirp.UserID,
-			})
+		if !hidden.has(authorUUID) {
+			for _, chirp := range newChirps {
+				chirps = append(chirps, chirpFromDB(chirp))
+			}
 		}
 	}
 
@@ -83,21 +94,28 @@ func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s}"`, err), http.StatusInternalServerError)
+		return
 	}
 
-	newChirp, err := cfg.db.GetChirp(r.Context(), u)
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusNotFound)
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
 	}
 
-	chirp := Chirp{
-		ID:        newChirp.ID,
-		CreatedAt: newChirp.CreatedAt,
-		UpdatedAt: newChirp.UpdatedAt,
-		Body:      newChirp.Body,
-		UserID:    newChirp.UserID,
+	newChirp, err := cfg.db.GetChirp(r.Context(), u)
+	if err != nil || hidden.has(newChirp.UserID) {
+		http.Error(w, `{"error":"Chirp not found."}`, http.StatusNotFound)
+		return
 	}
 
+	chirp := chirpFromDB(newChirp)
+
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	if err = json.NewEncoder(w).Encode(chirp); err != nil {
@@ -107,17 +125,21 @@ func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) handlePostChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	uuID, err := cfg.authenticate(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
 		return
 	}
 
-	uuID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	author, err := cfg.db.GetUserWithID(r.Context(), uuID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
 		return
 	}
+	if !author.EmailVerifiedAt.Valid {
+		http.Error(w, `{"error":"Verify your email before posting chirps."}`, http.StatusForbidden)
+		return
+	}
 
 	req := Req{}
 	err = json.NewDecoder(r.Body).Decode(&req)
@@ -130,21 +152,76 @@ func (cfg *apiConfig) handlePostChirp(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf(`{"error3":"%s"}`, err), http.StatusNotAcceptable)
 		return
 	}
+
+	replyToID := uuid.NullUUID{}
+	replyToAuthorID := uuid.Nil
+	if req.ReplyToID != nil {
+		parent, err := cfg.db.GetChirp(r.Context(), *req.ReplyToID)
+		if err != nil {
+			http.Error(w, `{"error":"Chirp to reply to not found."}`, http.StatusNotFound)
+			return
+		}
+		blocked, err := cfg.isBlocked(r.Context(), uuID, parent.UserID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, `{"error":"Not allowed to reply to this user."}`, http.StatusForbidden)
+			return
+		}
+		replyToID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		replyToAuthorID = parent.UserID
+	}
+
+	mentioned, err := cfg.mentionedUsers(r.Context(), req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	for _, mentionedID := range mentioned {
+		blocked, err := cfg.isBlocked(r.Context(), uuID, mentionedID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, `{"error":"Not allowed to mention this user."}`, http.StatusForbidden)
+			return
+		}
+	}
+
 	newChirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   req.Body,
-		UserID: uuID,
+		Body:      req.Body,
+		UserID:    uuID,
+		ReplyToID: replyToID,
 	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
-	chirp := Chirp{
-		ID:        newChirp.ID,
-		CreatedAt: newChirp.CreatedAt,
-		UpdatedAt: newChirp.UpdatedAt,
-		Body:      newChirp.Body,
-		UserID:    newChirp.UserID,
+	if err = cfg.timeline.AddChirp(r.Context(), newChirp); err != nil {
+		log.Printf("Failed to add chirp %s to timelines: %v", newChirp.ID, err)
+	}
+	if replyToID.Valid {
+		cfg.notifier.Notify(notificationJob{
+			UserID:  replyToAuthorID,
+			ActorID: uuID,
+			Kind:    notificationReply,
+			ChirpID: newChirp.ID,
+		})
+	}
+	for _, mentionedID := range mentioned {
+		cfg.notifier.Notify(notificationJob{
+			UserID:  mentionedID,
+			ActorID: uuID,
+			Kind:    notificationMention,
+			ChirpID: newChirp.ID,
+		})
 	}
+	chirp := chirpFromDB(newChirp)
+	publishEvent(r.Context(), cfg.events, eventChirpCreated, chirp)
+	cfg.webhooks.Enqueue(r.Context(), webhookChirpCreated, chirp.UserID, chirp)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -163,12 +240,7 @@ func (cfg *apiConfig) handleDeleteChirps(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		http.Error(w, `{"error": "Failed to get bearer token."}`, http.StatusUnauthorized)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.authenticate(r)
 	if err != nil {
 		http.Error(w, `{"error": "Failed to get bearer token."}`, http.StatusUnauthorized)
 		return
@@ -184,6 +256,7 @@ func (cfg *apiConfig) handleDeleteChirps(w http.ResponseWriter, r *http.Request)
 		http.Error(w, `{"error": "Failed to delete chirp."}`, http.StatusInternalServerError)
 		return
 	}
+	cfg.webhooks.Enqueue(r.Context(), webhookChirpDeleted, chirpData.UserID, chirpFromDB(chirpData))
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -209,3 +282,48 @@ func validateChirp(chirp string) (string, error) {
 	return strings.Join(words, " "), nil
 
 }
+
+// mentionedUsers returns the existing users mentioned in body, either as
+// @<handle> or as @<user id>.
+func (cfg *apiConfig) mentionedUsers(ctx context.Context, body string) ([]uuid.UUID, error) {
+	mentioned := []uuid.UUID{}
+	seen := userSet{}
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		handle := strings.TrimRight(word[1:], ".,:;!?")
+
+		id, err := uuid.Parse(handle)
+		if err != nil {
+			user, err := cfg.db.GetUserByUsername(ctx, handle)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			id = user.ID
+		}
+		if seen.has(id) {
+			continue
+		}
+		seen[id] = struct{}{}
+		mentioned = append(mentioned, id)
+	}
+	return mentioned, nil
+}
+
+func chirpFromDB(chirp database.Chirp) Chirp {
+	c := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}
+	if chirp.ReplyToID.Valid {
+		c.ReplyToID = &chirp.ReplyToID.UUID
+	}
+	return c
+}
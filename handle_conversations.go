@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxConversationMembers = 8
+
+var errNotConversationMember = errors.New("Conversation not found.")
+
+func (cfg *apiConfig) handlePostConversation(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		MemberIDs []uuid.UUID `json:"member_ids"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	memberIDs := []uuid.UUID{userID}
+	seen := userSet{userID: {}}
+	for _, id := range req.MemberIDs {
+		if seen.has(id) {
+			continue
+		}
+		seen[id] = struct{}{}
+		memberIDs = append(memberIDs, id)
+	}
+	if len(memberIDs) < 2 || len(memberIDs) > maxConversationMembers {
+		http.Error(w, fmt.Sprintf(`{"error":"Conversations need between 2 and %d members."}`, maxConversationMembers), http.StatusBadRequest)
+		return
+	}
+
+	for _, id := range memberIDs[1:] {
+		if _, err = cfg.db.GetUserWithID(r.Context(), id); err != nil {
+			http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+			return
+		}
+	}
+	// No one is put in a conversation with someone blocking them or blocked
+	// by them, whoever started it.
+	for i, id := range memberIDs {
+		for _, otherID := range memberIDs[i+1:] {
+			blocked, err := cfg.isBlocked(r.Context(), id, otherID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+				return
+			}
+			if blocked {
+				http.Error(w, `{"error":"Not allowed to message this user."}`, http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	newConversation, err := qtx.CreateConversation(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	for _, id := range memberIDs {
+		err = qtx.AddConversationMember(r.Context(), database.AddConversationMemberParams{
+			ConversationID: newConversation.ID,
+			UserID:         id,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	conversation, err := cfg.loadConversation(r.Context(), newConversation, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(conversation); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetConversations(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := cfg.db.GetUserConversations(r.Context(), database.GetUserConversationsParams{
+		UserID:    userID,
+		UpdatedAt: p.Before,
+		ID:        p.BeforeID,
+		Limit:     p.Limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[Conversation]{Items: make([]Conversation, 0, len(rows))}
+	for _, row := range rows {
+		conversation, err := cfg.loadConversation(r.Context(), row, userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		page.Items = append(page.Items, conversation)
+	}
+	if len(rows) > 0 {
+		page.NextCursor = p.nextCursor(len(rows), rows[len(rows)-1].UpdatedAt, rows[len(rows)-1].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	conversationID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct conversation id."}`, http.StatusBadRequest)
+		return
+	}
+
+	newConversation, err := cfg.db.GetConversation(r.Context(), conversationID)
+	if err != nil {
+		http.Error(w, `{"error":"Conversation not found."}`, http.StatusNotFound)
+		return
+	}
+
+	conversation, err := cfg.loadConversation(r.Context(), newConversation, userID)
+	if errors.Is(err, errNotConversationMember) {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(conversation); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	conversationID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct conversation id."}`, http.StatusBadRequest)
+		return
+	}
+
+	members, err := cfg.db.GetConversationMembers(r.Context(), conversationID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if !isConversationMember(members, userID) {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errNotConversationMember), http.StatusNotFound)
+		return
+	}
+
+	type Req struct {
+		Body string `json:"body"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+	if req.Body, err = validateChirp(req.Body); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusNotAcceptable)
+		return
+	}
+
+	// A block made after the conversation started closes a direct
+	// conversation. Otherwise members hiding the sender are not notified.
+	recipients := make([]database.ConversationMember, 0, len(members))
+	for _, member := range members {
+		if member.UserID == userID {
+			continue
+		}
+		hidden, err := cfg.hiddenUsers(r.Context(), member.UserID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		if !hidden.has(userID) {
+			recipients = append(recipients, member)
+			continue
+		}
+		if len(members) == 2 {
+			blocked, err := cfg.isBlocked(r.Context(), userID, member.UserID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+				return
+			}
+			if blocked {
+				http.Error(w, `{"error":"Not allowed to message this user."}`, http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	newMessage, err := cfg.db.CreateMessage(r.Context(), database.CreateMessageParams{
+		ConversationID: conversationID,
+		SenderID:       userID,
+		Body:           req.Body,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if err = cfg.db.TouchConversation(r.Context(), conversationID); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	err = cfg.db.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	for _, member := range recipients {
+		if member.Muted {
+			continue
+		}
+		cfg.notifier.Notify(notificationJob{
+			UserID:  member.UserID,
+			ActorID: userID,
+			Kind:    notificationMessage,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(messageFromDB(newMessage)); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetMessages(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	conversationID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct conversation id."}`, http.StatusBadRequest)
+		return
+	}
+
+	_, err = cfg.db.GetConversationMember(r.Context(), database.GetConversationMemberParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errNotConversationMember), http.StatusNotFound)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := cfg.db.GetMessages(r.Context(), database.GetMessagesParams{
+		ConversationID: conversationID,
+		CreatedAt:      p.Before,
+		ID:             p.BeforeID,
+		Limit:          p.Limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	hidden, err := cfg.hiddenUsers(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[Message]{Items: make([]Message, 0, len(rows))}
+	for _, row := range rows {
+		if hidden.has(row.SenderID) {
+			continue
+		}
+		page.Items = append(page.Items, messageFromDB(row))
+	}
+	if len(rows) > 0 {
+		page.NextCursor = p.nextCursor(len(rows), rows[len(rows)-1].CreatedAt, rows[len(rows)-1].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleReadConversation(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	conversationID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct conversation id."}`, http.StatusBadRequest)
+		return
+	}
+
+	_, err = cfg.db.GetConversationMember(r.Context(), database.GetConversationMemberParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errNotConversationMember), http.StatusNotFound)
+		return
+	}
+
+	err = cfg.db.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleMuteConversation(w http.ResponseWriter, r *http.Request) {
+	cfg.setConversationMuted(w, r, true)
+}
+
+func (cfg *apiConfig) handleUnmuteConversation(w http.ResponseWriter, r *http.Request) {
+	cfg.setConversationMuted(w, r, false)
+}
+
+func (cfg *apiConfig) setConversationMuted(w http.ResponseWriter, r *http.Request, muted bool) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	conversationID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct conversation id."}`, http.StatusBadRequest)
+		return
+	}
+
+	_, err = cfg.db.GetConversationMember(r.Context(), database.GetConversationMemberParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errNotConversationMember), http.StatusNotFound)
+		return
+	}
+
+	err = cfg.db.SetConversationMuted(r.Context(), database.SetConversationMutedParams{
+		Muted:          muted,
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadConversation returns c as seen by userID, with the read receipts of
+// every member. It fails with errNotConversationMember when userID is not
+// part of c.
+func (cfg *apiConfig) loadConversation(ctx context.Context, c database.Conversation, userID uuid.UUID) (Conversation, error) {
+	members, err := cfg.db.GetConversationMembers(ctx, c.ID)
+	if err != nil {
+		return Conversation{}, err
+	}
+	if !isConversationMember(members, userID) {
+		return Conversation{}, errNotConversationMember
+	}
+
+	conversation := Conversation{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Members:   make([]ConversationMember, 0, len(members)),
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			conversation.Muted = member.Muted
+		}
+		m := ConversationMember{UserID: member.UserID}
+		if member.LastReadAt.Valid {
+			m.LastReadAt = &member.LastReadAt.Time
+		}
+		conversation.Members = append(conversation.Members, m)
+	}
+	return conversation, nil
+}
+
+func isConversationMember(members []database.ConversationMember, userID uuid.UUID) bool {
+	for _, member := range members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func messageFromDB(m database.Message) Message {
+	return Message{
+		ID:             m.ID,
+		CreatedAt:      m.CreatedAt,
+		ConversationID: m.ConversationID,
+		SenderID:       m.SenderID,
+		Body:           m.Body,
+	}
+}
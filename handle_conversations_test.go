@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+// blockedPair reports whether args of IsBlockedEitherWay name a and b.
+func blockedPair(args []driver.Value, a, b uuid.UUID) bool {
+	return (args[0] == a.String() && args[1] == b.String()) ||
+		(args[0] == b.String() && args[1] == a.String())
+}
+
+// memberResult answers GetConversationMembers with userIDs.
+func memberResult(conversationID uuid.UUID, userIDs ...uuid.UUID) fakeResult {
+	res := fakeResult{columns: []string{"conversation_id", "user_id", "joined_at", "last_read_at", "muted"}}
+	for _, id := range userIDs {
+		res.rows = append(res.rows, []driver.Value{conversationID.String(), id.String(), time.Now(), nil, false})
+	}
+	return res
+}
+
+func TestPostConversationBlockedBetweenInvitees(t *testing.T) {
+	creator, first, second := uuid.New(), uuid.New(), uuid.New()
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		switch name {
+		case "GetUserWithID":
+			id, _ := uuid.Parse(args[0].(string))
+			return userResult(database.User{ID: id}), nil
+		case "IsBlockedEitherWay":
+			blocked := blockedPair(args, first, second)
+			return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{blocked}}}, nil
+		}
+		t.Errorf("unexpected query %s %v", name, args)
+		return fakeResult{}, nil
+	})
+
+	r := authorizedRequest(t, cfg, http.MethodPost, "/api/conversations", creator)
+	r.Body = io.NopCloser(strings.NewReader(fmt.Sprintf(`{"member_ids":["%s","%s"]}`, first, second)))
+	w := httptest.NewRecorder()
+	cfg.handlePostConversation(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestPostMessageBlocks(t *testing.T) {
+	sender, friend, blocker := uuid.New(), uuid.New(), uuid.New()
+	conversationID := uuid.New()
+
+	tests := []struct {
+		name     string
+		members  []uuid.UUID
+		wantCode int
+		notified []uuid.UUID
+	}{
+		{"group skips blocking member", []uuid.UUID{sender, friend, blocker}, http.StatusCreated, []uuid.UUID{friend}},
+		{"direct is closed", []uuid.UUID{sender, blocker}, http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+				switch name {
+				case "GetConversationMembers":
+					return memberResult(conversationID, tt.members...), nil
+				case "GetHiddenUserIDs":
+					res := fakeResult{columns: []string{"user_id"}}
+					if args[0] == blocker.String() {
+						res.rows = [][]driver.Value{{sender.String()}}
+					}
+					return res, nil
+				case "IsBlockedEitherWay":
+					blocked := blockedPair(args, sender, blocker)
+					return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{blocked}}}, nil
+				case "CreateMessage":
+					return fakeResult{
+						columns: []string{"id", "created_at", "conversation_id", "sender_id", "body"},
+						rows:    [][]driver.Value{{uuid.NewString(), time.Now(), args[0], args[1], args[2]}},
+					}, nil
+				case "TouchConversation", "MarkConversationRead":
+					return fakeResult{affected: 1}, nil
+				}
+				t.Errorf("unexpected query %s %v", name, args)
+				return fakeResult{}, nil
+			})
+			cfg.notifier = newNotifier(cfg.db, nil)
+
+			r := authorizedRequest(t, cfg, http.MethodPost, "/api/conversations/"+conversationID.String()+"/messages", sender)
+			r.Body = io.NopCloser(strings.NewReader(`{"body":"hello"}`))
+			r.SetPathValue("id", conversationID.String())
+			w := httptest.NewRecorder()
+			cfg.handlePostMessage(w, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			notified := []uuid.UUID{}
+			for len(cfg.notifier.queue) > 0 {
+				notified = append(notified, (<-cfg.notifier.queue).UserID)
+			}
+			if fmt.Sprint(notified) != fmt.Sprint(tt.notified) {
+				t.Fatalf("notified %v, want %v", notified, tt.notified)
+			}
+		})
+	}
+}
+
+func TestConversationSettingsNeedMembership(t *testing.T) {
+	userID, conversationID := uuid.New(), uuid.New()
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		if name != "GetConversationMember" {
+			t.Errorf("unexpected query %s %v", name, args)
+		}
+		return fakeResult{columns: []string{"conversation_id", "user_id", "joined_at", "last_read_at", "muted"}}, nil
+	})
+
+	handlers := map[string]http.HandlerFunc{
+		"read":   cfg.handleReadConversation,
+		"mute":   cfg.handleMuteConversation,
+		"unmute": cfg.handleUnmuteConversation,
+	}
+	for name, handle := range handlers {
+		t.Run(name, func(t *testing.T) {
+			r := authorizedRequest(t, cfg, http.MethodPost, "/api/conversations/"+conversationID.String()+"/"+name, userID)
+			r.SetPathValue("id", conversationID.String())
+			w := httptest.NewRecorder()
+			handle(w, r)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+		})
+	}
+}
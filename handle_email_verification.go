@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// sendVerificationEmail mails a link proving the owner of userID reads
+// email. Each link works once, and only while the user still has email.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	id := uuid.New()
+	token, err := cfg.keys.MakeEmailToken(userID, id, email, emailVerificationDuration)
+	if err != nil {
+		return err
+	}
+	err = cfg.db.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		ID:        id,
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s%susers/verify?token=%s", cfg.publicURL, backPath, url.QueryEscape(token))
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\nOpen this link to verify your email:\n\n%s\n\nThe link expires in %s.\n",
+			link, emailVerificationDuration),
+	})
+}
+
+func (cfg *apiConfig) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.keys.ParseEmailToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid or expired verification link."}`, http.StatusBadRequest)
+		return
+	}
+	id, err := uuid.Parse(claims.ID)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid or expired verification link."}`, http.StatusBadRequest)
+		return
+	}
+
+	verification, err := cfg.db.UseEmailVerification(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Invalid or expired verification link."}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if verification.UserID.String() != claims.Subject || verification.Email != claims.Email {
+		http.Error(w, `{"error":"Invalid or expired verification link."}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := cfg.db.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Email changed since the link was sent."}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	type Res struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(Res{Email: user.Email, EmailVerified: user.EmailVerifiedAt.Valid}); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		http.Error(w, `{"error":"Email already verified."}`, http.StatusConflict)
+		return
+	}
+
+	if err = cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+func (cfg *apiConfig) handleFollowUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	targetID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+	if targetID == userID {
+		http.Error(w, `{"error":"Users can not follow themselves."}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err = cfg.db.GetUserWithID(r.Context(), targetID); err != nil {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	blocked, err := cfg.isBlocked(r.Context(), userID, targetID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, `{"error":"Not allowed to follow this user."}`, http.StatusForbidden)
+		return
+	}
+
+	alreadyFollowing, err := cfg.db.IsFollowing(r.Context(), database.IsFollowingParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	err = cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if !alreadyFollowing {
+		if err = cfg.timeline.Follow(r.Context(), userID, targetID); err != nil {
+			log.Printf("Failed to backfill timeline of %s: %v", userID, err)
+		}
+		cfg.notifier.Notify(notificationJob{
+			UserID:  targetID,
+			ActorID: userID,
+			Kind:    notificationFollow,
+		})
+	}
+
+	isMutual, err := cfg.db.IsFollowing(r.Context(), database.IsFollowingParams{
+		FollowerID: targetID,
+		FolloweeID: userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	follow := Follow{
+		FollowerID: userID,
+		FolloweeID: targetID,
+		IsMutual:   isMutual,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(follow); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	targetID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if err = cfg.timeline.Unfollow(r.Context(), userID, targetID); err != nil {
+		log.Printf("Failed to clean timeline of %s: %v", userID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetUserRelation serves the listings under /api/users/{id}/. They
+// share a single pattern, as separate ones would conflict with
+// /api/users/by-handle/{handle}.
+func (cfg *apiConfig) handleGetUserRelation(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("relation") {
+	case "followers":
+		cfg.handleGetFollowers(w, r)
+	case "following":
+		cfg.handleGetFollowing(w, r)
+	case "lists":
+		cfg.handleGetUserLists(w, r)
+	default:
+		http.Error(w, `{"error":"Not found."}`, http.StatusNotFound)
+	}
+}
+
+func (cfg *apiConfig) handleGetFollowers(w http.ResponseWriter, r *http.Request) {
+	userID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if hidden.has(userID) {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	rows, err := cfg.db.GetFollowers(r.Context(), database.GetFollowersParams{
+		FolloweeID: userID,
+		CreatedAt:  p.Before,
+		FollowerID: p.BeforeID,
+		Limit:      p.Limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[FollowEntry]{Items: make([]FollowEntry, 0, len(rows))}
+	for _, row := range rows {
+		if hidden.has(row.UserID) {
+			continue
+		}
+		page.Items = append(page.Items, FollowEntry{
+			UserID:     row.UserID,
+			FollowedAt: row.CreatedAt,
+			IsMutual:   row.IsMutual,
+		})
+	}
+	if len(rows) > 0 {
+		page.NextCursor = p.nextCursor(len(rows), rows[len(rows)-1].CreatedAt, rows[len(rows)-1].UserID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetFollowing(w http.ResponseWriter, r *http.Request) {
+	userID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if hidden.has(userID) {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	rows, err := cfg.db.GetFollowing(r.Context(), database.GetFollowingParams{
+		FollowerID: userID,
+		CreatedAt:  p.Before,
+		FolloweeID: p.BeforeID,
+		Limit:      p.Limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[FollowEntry]{Items: make([]FollowEntry, 0, len(rows))}
+	for _, row := range rows {
+		if hidden.has(row.UserID) {
+			continue
+		}
+		page.Items = append(page.Items, FollowEntry{
+			UserID:     row.UserID,
+			FollowedAt: row.CreatedAt,
+			IsMutual:   row.IsMutual,
+		})
+	}
+	if len(rows) > 0 {
+		page.NextCursor = p.nextCursor(len(rows), rows[len(rows)-1].CreatedAt, rows[len(rows)-1].UserID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
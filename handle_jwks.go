@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+)
+
+// loadKeyring builds the keyring access tokens are signed with. Without a
+// signing key file tokens keep being signed with HS256 and JWT_SECRET.
+// verificationKeyFiles is a comma separated list of the public keys of
+// previous signing keys, still trusted while their tokens live.
+func loadKeyring(signingKeyFile, verificationKeyFiles, jwtSecret string) (*auth.Keyring, error) {
+	paths := []string{}
+	for _, path := range strings.Split(verificationKeyFiles, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return auth.LoadKeyring(signingKeyFile, paths, jwtSecret)
+}
+
+func (cfg *apiConfig) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(cfg.keys.JWKS()); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
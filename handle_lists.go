@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxListNameLength = 50
+
+var errListNotFound = errors.New("List not found.")
+
+func (cfg *apiConfig) handlePostList(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		Name      string `json:"name"`
+		IsPrivate bool   `json:"is_private"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxListNameLength {
+		http.Error(w, fmt.Sprintf(`{"error":"List names must have between 1 and %d characters."}`, maxListNameLength), http.StatusBadRequest)
+		return
+	}
+
+	newList, err := cfg.db.CreateList(r.Context(), database.CreateListParams{
+		OwnerID:   userID,
+		Name:      req.Name,
+		IsPrivate: req.IsPrivate,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(listFromDB(newList, []uuid.UUID{})); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetList(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct list id."}`, http.StatusBadRequest)
+		return
+	}
+
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	l, err := cfg.visibleList(r.Context(), listID, viewerID, hidden)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errListNotFound), http.StatusNotFound)
+		return
+	}
+
+	memberIDs, err := cfg.db.GetListMemberIDs(r.Context(), l.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	visibleIDs := make([]uuid.UUID, 0, len(memberIDs))
+	for _, id := range memberIDs {
+		if !hidden.has(id) {
+			visibleIDs = append(visibleIDs, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(listFromDB(l, visibleIDs)); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetUserLists(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	ownerID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if hidden.has(ownerID) {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	rows, err := cfg.db.GetUserLists(r.Context(), ownerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	lists := make([]List, 0, len(rows))
+	for _, row := range rows {
+		if row.IsPrivate && row.OwnerID != viewerID {
+			continue
+		}
+		lists = append(lists, listFromDB(row, nil))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(lists); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleDeleteList(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct list id."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.DeleteList(r.Context(), database.DeleteListParams{
+		ID:      listID,
+		OwnerID: userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleAddListMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct list id."}`, http.StatusBadRequest)
+		return
+	}
+
+	type Req struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	l, err := cfg.db.GetList(r.Context(), listID)
+	if err != nil || l.OwnerID != userID {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errListNotFound), http.StatusNotFound)
+		return
+	}
+
+	if _, err = cfg.db.GetUserWithID(r.Context(), req.UserID); err != nil {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+	blocked, err := cfg.isBlocked(r.Context(), userID, req.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, `{"error":"Not allowed to add this user."}`, http.StatusForbidden)
+		return
+	}
+
+	err = cfg.db.AddListMember(r.Context(), database.AddListMemberParams{
+		ListID: listID,
+		UserID: req.UserID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleRemoveListMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct list id."}`, http.StatusBadRequest)
+		return
+	}
+	memberID, err := stringToUUID(r.PathValue("user_id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	l, err := cfg.db.GetList(r.Context(), listID)
+	if err != nil || l.OwnerID != userID {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errListNotFound), http.StatusNotFound)
+		return
+	}
+
+	err = cfg.db.RemoveListMember(r.Context(), database.RemoveListMemberParams{
+		ListID: listID,
+		UserID: memberID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleGetListTimeline(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct list id."}`, http.StatusBadRequest)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	l, err := cfg.visibleList(r.Context(), listID, viewerID, hidden)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errListNotFound), http.StatusNotFound)
+		return
+	}
+
+	newChirps, err := cfg.db.GetListTimeline(r.Context(), database.GetListTimelineParams{
+		ListID:    l.ID,
+		CreatedAt: p.Before,
+		ID:        p.BeforeID,
+		Limit:     p.Limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[Chirp]{Items: make([]Chirp, 0, len(newChirps))}
+	for _, chirp := range newChirps {
+		if hidden.has(chirp.UserID) {
+			continue
+		}
+		page.Items = append(page.Items, chirpFromDB(chirp))
+	}
+	if len(newChirps) > 0 {
+		page.NextCursor = p.nextCursor(len(newChirps), newChirps[len(newChirps)-1].CreatedAt, newChirps[len(newChirps)-1].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// visibleList returns the list listID if viewerID may see it: private lists
+// are only visible to their owner, and lists of hidden users to nobody.
+func (cfg *apiConfig) visibleList(ctx context.Context, listID, viewerID uuid.UUID, hidden userSet) (database.List, error) {
+	l, err := cfg.db.GetList(ctx, listID)
+	if err != nil {
+		return database.List{}, err
+	}
+	if l.IsPrivate && l.OwnerID != viewerID {
+		return database.List{}, errListNotFound
+	}
+	if hidden.has(l.OwnerID) {
+		return database.List{}, errListNotFound
+	}
+	return l, nil
+}
+
+func listFromDB(l database.List, memberIDs []uuid.UUID) List {
+	return List{
+		ID:        l.ID,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+		OwnerID:   l.OwnerID,
+		Name:      l.Name,
+		IsPrivate: l.IsPrivate,
+		MemberIDs: memberIDs,
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const totpIssuer = "Chirpy"
+
+const (
+	mfaAttemptUser  = "mfa"
+	mfaAttemptToken = "mfa_token"
+)
+
+// maxMFATokenFailures is how many wrong codes an MFA token takes before it
+// stops working.
+const maxMFATokenFailures = 5
+
+var (
+	mfaLockout = auth.LockoutPolicy{
+		FreeAttempts:    5,
+		BaseDelay:       time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          24 * time.Hour,
+	}
+	// Locked for as long as it lives, the token is as good as revoked.
+	mfaTokenLockout = auth.LockoutPolicy{
+		FreeAttempts:    maxMFATokenFailures,
+		LockoutAfter:    maxMFATokenFailures,
+		LockoutDuration: mfaChallengeDuration,
+		Window:          mfaChallengeDuration,
+	}
+)
+
+var errInvalidSecondFactor = errors.New("Invalid code.")
+
+// writeMFAChallenge answers a login whose password was right with a short
+// lived token, to be sent back with a code to POST /api/login/mfa.
+func (cfg *apiConfig) writeMFAChallenge(w http.ResponseWriter, userID uuid.UUID) {
+	token, err := cfg.keys.MakeMFAToken(userID, mfaChallengeDuration)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	type Res struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(Res{MFARequired: true, MFAToken: token}); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+// Failures are counted like those of passwords, per user and per ip, and
+// per mfaToken when the code comes with one, which stops working after
+// maxMFATokenFailures of them.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, totp database.UserTotp, code, recoveryCode, ip, mfaToken string) error {
+	keys := []attemptKey{}
+	if mfaToken != "" {
+		keys = append(keys, attemptKey{kind: mfaAttemptToken, key: auth.HashRefreshToken(mfaToken), policy: mfaTokenLockout})
+	}
+	keys = append(keys,
+		attemptKey{kind: mfaAttemptUser, key: totp.UserID.String(), policy: mfaLockout},
+		attemptKey{kind: loginFailureIP, key: ip, policy: ipLockout, shared: true},
+	)
+	if err := cfg.beginAttempt(ctx, keys); err != nil {
+		return err
+	}
+	if err := cfg.verifySecondFactor(ctx, totp, code, recoveryCode); err != nil {
+		return err
+	}
+	cfg.succeedAttempt(ctx, keys)
+	return nil
+}
+
+// verifySecondFactor does the checking for checkSecondFactor. A TOTP code is
+// accepted once, even inside its validity window.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, totp database.UserTotp, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		_, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(recoveryCode),
+			UserID:   totp.UserID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return errInvalidSecondFactor
+	}
+	_, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       totp.UserID,
+		LastUsedStep: step,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return errInvalidSecondFactor
+	}
+	return err
+}
+
+func (cfg *apiConfig) handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type Req struct {
+		MFAToken         string `json:"mfa_token"`
+		Code             string `json:"code"`
+		RecoveryCode     string `json:"recovery_code"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+	req := Req{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInSeconds == 0 || req.ExpiresInSeconds > defaultExpSeconds {
+		req.ExpiresInSeconds = defaultExpSeconds
+	}
+
+	userID, err := cfg.keys.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid or expired MFA token."}`, http.StatusUnauthorized)
+		return
+	}
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid or expired MFA token."}`, http.StatusUnauthorized)
+		return
+	}
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userID)
+	if err != nil || !totp.ConfirmedAt.Valid {
+		http.Error(w, `{"error":"Invalid or expired MFA token."}`, http.StatusUnauthorized)
+		return
+	}
+
+	err = cfg.checkSecondFactor(r.Context(), totp, req.Code, req.RecoveryCode, clientIP(r), req.MFAToken)
+	var locked *attemptLockedError
+	switch {
+	case errors.As(err, &locked) && locked.kind == mfaAttemptToken:
+		http.Error(w, `{"error":"Invalid or expired MFA token."}`, http.StatusUnauthorized)
+		return
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", locked.retryAfter())
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, errInvalidSecondFactor):
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	cfg.writeLogin(w, r, user, time.Duration(req.ExpiresInSeconds)*time.Second)
+}
+
+// handleEnrollTOTP starts an enrollment. Two-factor authentication is only
+// enabled once a code of the new secret is confirmed, so a user who never
+// finished scanning the QR code can not lock themselves out.
+func (cfg *apiConfig) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	_, err = cfg.db.EnrollUserTOTP(r.Context(), database.EnrollUserTOTPParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Two-factor authentication already enabled."}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	type Res struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(Res{Secret: secret, URI: auth.TOTPURI(totpIssuer, user.Email, secret)}); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleConfirmTOTP enables two-factor authentication and returns the
+// recovery codes. They are only shown this once.
+func (cfg *apiConfig) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		Code string `json:"code"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"No two-factor enrollment to confirm."}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		http.Error(w, `{"error":"Two-factor authentication already enabled."}`, http.StatusConflict)
+		return
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errInvalidSecondFactor), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	_, err = qtx.ConfirmUserTOTP(r.Context(), database.ConfirmUserTOTPParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Two-factor authentication already enabled."}`, http.StatusConflict)
+		return
+	}
+	if err == nil {
+		err = qtx.DeleteRecoveryCodes(r.Context(), userID)
+	}
+	for _, code := range codes {
+		if err != nil {
+			break
+		}
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(code),
+			UserID:   userID,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	type Res struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(Res{RecoveryCodes: codes}); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDisableTOTP asks for the password and a second factor again, so a
+// stolen access token is not enough to turn two-factor authentication off.
+// Both are checked as one second factor attempt of the user, so the token
+// can not be used to guess either.
+func (cfg *apiConfig) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	keys := []attemptKey{
+		{kind: mfaAttemptUser, key: userID.String(), policy: mfaLockout},
+		{kind: loginFailureIP, key: clientIP(r), policy: ipLockout, shared: true},
+	}
+	err = cfg.beginAttempt(r.Context(), keys)
+	var locked *attemptLockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", locked.retryAfter())
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	if err = auth.CheckPasswordHash(user.HashedPassword, req.Password); err != nil {
+		http.Error(w, `{"error":"Incorrect password."}`, http.StatusUnauthorized)
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Two-factor authentication is not enabled."}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		err = cfg.verifySecondFactor(r.Context(), totp, req.Code, req.RecoveryCode)
+		if errors.Is(err, errInvalidSecondFactor) {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	cfg.succeedAttempt(r.Context(), keys)
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.DeleteUserTOTP(r.Context(), userID)
+	if err == nil {
+		err = qtx.DeleteRecoveryCodes(r.Context(), userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
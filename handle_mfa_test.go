@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestDisableTOTPThrottled(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name          string
+		failures      int64
+		lastFailureAt time.Time
+		wantCode      int
+		queries       []string
+	}{
+		{"locked out", int64(mfaLockout.LockoutAfter), time.Now().UTC(), http.StatusTooManyRequests, []string{"LockAttemptFailure", "LockAttemptFailure"}},
+		{"wrong password counts", 0, time.Now().UTC().Add(-time.Minute), http.StatusUnauthorized, []string{"LockAttemptFailure", "LockAttemptFailure", "RecordAttemptFailure", "RecordAttemptFailure", "GetUserWithID"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := []string{}
+			cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+				queries = append(queries, name)
+				switch name {
+				case "LockAttemptFailure":
+					switch {
+					case args[0] == loginFailureIP && args[1] == "192.0.2.1":
+						return attemptFailureResult(args, 0, time.Now().UTC().Add(-time.Minute)), nil
+					case args[0] != mfaAttemptUser || args[1] != userID.String():
+						t.Errorf("attempt counted for %v %v", args[0], args[1])
+					}
+					return attemptFailureResult(args, tt.failures, tt.lastFailureAt), nil
+				case "RecordAttemptFailure":
+					return attemptFailureResult(args, tt.failures+1, time.Now().UTC()), nil
+				case "GetUserWithID":
+					return userResult(database.User{ID: userID, HashedPassword: "not a hash"}), nil
+				}
+				return fakeResult{}, nil
+			})
+
+			r := authorizedRequest(t, cfg, http.MethodDelete, "/api/users/me/totp", userID)
+			r.Body = io.NopCloser(strings.NewReader(`{"password":"guess","code":"123456"}`))
+			w := httptest.NewRecorder()
+			cfg.handleDisableTOTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if strings.Join(queries, ",") != strings.Join(tt.queries, ",") {
+				t.Fatalf("queries = %v, want %v", queries, tt.queries)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handleGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := cfg.db.GetNotifications(r.Context(), database.GetNotificationsParams{
+		UserID:     userID,
+		Before:     p.Before,
+		BeforeID:   p.BeforeID,
+		UnreadOnly: r.URL.Query().Get("unread") == "true",
+		PageSize:   p.Limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	hidden, err := cfg.hiddenUsers(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[Notification]{Items: make([]Notification, 0, len(rows))}
+	for _, row := range rows {
+		if row.ActorID.Valid && hidden.has(row.ActorID.UUID) {
+			continue
+		}
+		page.Items = append(page.Items, notificationFromDB(row))
+	}
+	if len(rows) > 0 {
+		page.NextCursor = p.nextCursor(len(rows), rows[len(rows)-1].CreatedAt, rows[len(rows)-1].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleReadNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	if len(req.IDs) == 0 {
+		err = cfg.db.MarkAllNotificationsRead(r.Context(), userID)
+	} else {
+		err = cfg.db.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID: userID,
+			Ids:    req.IDs,
+		})
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetUnreadCount leaves out notifications from hidden actors, like
+// handleGetNotifications does, so the count matches the list.
+func (cfg *apiConfig) handleGetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	count, err := cfg.db.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"count":%d}`, count)))
+}
+
+func notificationFromDB(n database.Notification) Notification {
+	notification := Notification{
+		ID:        n.ID,
+		CreatedAt: n.CreatedAt,
+		Kind:      n.Kind,
+	}
+	if n.ActorID.Valid {
+		notification.ActorID = &n.ActorID.UUID
+	}
+	if n.ChirpID.Valid {
+		notification.ChirpID = &n.ChirpID.UUID
+	}
+	if n.ReadAt.Valid {
+		notification.ReadAt = &n.ReadAt.Time
+	}
+	return notification
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Authorize {{.ClientName}} - Chirpy</title>
+</head>
+<body>
+<h1>{{.ClientName}} wants to access your Chirpy account</h1>
+<p>It will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username"></label></p>
+<p><label>Password <input type="password" name="password" autocomplete="current-password"></label></p>
+<p><label>Two-factor code, if enabled <input name="code" inputmode="numeric" autocomplete="one-time-code"></label></p>
+<p>
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</p>
+</form>
+<p>You will then be sent back to {{.RedirectURI}}</p>
+</body>
+</html>
+`))
+
+// authorizeParams are the parameters of an authorization request carried
+// from the consent screen to its form submission.
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"}
+
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Description
+}
+
+// parseAuthorizeRequest validates an authorization request. Until the
+// client and its redirect URI are known to be right, the returned request
+// has no RedirectURI: errors must then be shown to the user rather than
+// sent to a URI anyone could have picked.
+func (cfg *apiConfig) parseAuthorizeRequest(ctx context.Context, v url.Values) (authorizeRequest, error) {
+	req := authorizeRequest{State: v.Get("state")}
+
+	clientID, err := uuid.Parse(v.Get("client_id"))
+	if err != nil {
+		return req, &oauthError{"invalid_request", "Unknown client."}
+	}
+	req.Client, err = cfg.db.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, &oauthError{"invalid_request", "Unknown client."}
+	}
+	if err != nil {
+		return req, err
+	}
+	if !slices.Contains(req.Client.RedirectUris, v.Get("redirect_uri")) {
+		return req, &oauthError{"invalid_request", "Redirect URI not registered for this client."}
+	}
+	req.RedirectURI = v.Get("redirect_uri")
+
+	if v.Get("response_type") != "code" {
+		return req, &oauthError{"unsupported_response_type", "Only the code response type is supported."}
+	}
+	if req.Scopes, err = parseScopes(v.Get("scope")); err != nil {
+		return req, &oauthError{"invalid_scope", err.Error()}
+	}
+	req.CodeChallenge = v.Get("code_challenge")
+	if req.CodeChallenge == "" || v.Get("code_challenge_method") != auth.PKCEMethodS256 {
+		return req, &oauthError{"invalid_request", "PKCE with the S256 method is required."}
+	}
+	return req, nil
+}
+
+// oauthRedirect sends the user agent back to the client with params added
+// to its redirect URI.
+func oauthRedirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect URI.", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for name, values := range params {
+		q[name] = values
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// writeAuthorizeError reports err to the client, or to the user when the
+// redirect URI can not be trusted yet.
+func writeAuthorizeError(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error) {
+	oerr := &oauthError{}
+	if !errors.As(err, &oerr) {
+		log.Printf("Failed to authorize OAuth request: %v", err)
+		oerr = &oauthError{"server_error", "Something went wrong."}
+	}
+	if req.RedirectURI == "" {
+		http.Error(w, oerr.Description, http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{"error": {oerr.Code}, "error_description": {oerr.Description}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	oauthRedirect(w, r, req.RedirectURI, params)
+}
+
+// writeConsent renders the consent screen. Users sign in on it, so the app
+// asking for access never sees their password.
+func writeConsent(w http.ResponseWriter, req authorizeRequest, params url.Values, email, message string, status int) {
+	descriptions := []string{}
+	for _, scope := range oauthScopes {
+		if slices.Contains(req.Scopes, scope.Name) {
+			descriptions = append(descriptions, scope.Description)
+		}
+	}
+	hidden := map[string]string{}
+	for _, name := range authorizeParams {
+		hidden[name] = params.Get(name)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	err := consentTemplate.Execute(w, map[string]any{
+		"ClientName":  req.Client.Name,
+		"Scopes":      descriptions,
+		"RedirectURI": req.RedirectURI,
+		"Action":      oauthPath + "authorize",
+		"Params":      hidden,
+		"Email":       email,
+		"Error":       message,
+	})
+	if err != nil {
+		log.Printf("Failed to render consent screen: %v", err)
+	}
+}
+
+func (cfg *apiConfig) handleGetAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		writeAuthorizeError(w, r, req, err)
+		return
+	}
+	writeConsent(w, req, r.URL.Query(), "", "", http.StatusOK)
+}
+
+func (cfg *apiConfig) handlePostAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form.", http.StatusBadRequest)
+		return
+	}
+	req, err := cfg.parseAuthorizeRequest(r.Context(), r.PostForm)
+	if err != nil {
+		writeAuthorizeError(w, r, req, err)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "allow" {
+		writeAuthorizeError(w, r, req, &oauthError{"access_denied", "The user denied access."})
+		return
+	}
+
+	email := r.PostForm.Get("email")
+	user, err := cfg.checkLogin(r.Context(), email, r.PostForm.Get("password"), clientIP(r))
+	var locked *attemptLockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", locked.retryAfter())
+		writeConsent(w, req, r.PostForm, email, err.Error(), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, errLoginFailed):
+		writeConsent(w, req, r.PostForm, email, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		writeAuthorizeError(w, r, req, err)
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), user.ID)
+	if err == nil && totp.ConfirmedAt.Valid {
+		err = cfg.checkSecondFactor(r.Context(), totp, r.PostForm.Get("code"), "", clientIP(r), "")
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", locked.retryAfter())
+			writeConsent(w, req, r.PostForm, email, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, errInvalidSecondFactor) {
+			writeConsent(w, req, r.PostForm, email, "Invalid two-factor code.", http.StatusUnauthorized)
+			return
+		}
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeAuthorizeError(w, r, req, err)
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeAuthorizeError(w, r, req, err)
+		return
+	}
+	err = cfg.db.CreateOAuthCode(r.Context(), database.CreateOAuthCodeParams{
+		CodeHash:      auth.HashRefreshToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        user.ID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeDuration),
+	})
+	if err != nil {
+		writeAuthorizeError(w, r, req, err)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	oauthRedirect(w, r, req.RedirectURI, params)
+}
+
+func writeOAuthJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode OAuth response: %v", err)
+	}
+}
+
+// authenticateOAuthClient identifies the client of a token or revocation
+// request, from HTTP Basic credentials or the client_id and client_secret
+// form fields. Public clients only send their client_id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, &oauthError{"invalid_client", "Unknown client."}
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, &oauthError{"invalid_client", "Unknown client."}
+	}
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	if client.SecretHash != "" && subtle.ConstantTimeCompare([]byte(auth.HashRefreshToken(secret)), []byte(client.SecretHash)) != 1 {
+		return database.OauthClient{}, &oauthError{"invalid_client", "Client authentication failed."}
+	}
+	return client, nil
+}
+
+// handleOAuthToken exchanges an authorization code for an access token.
+func (cfg *apiConfig) handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{"invalid_request", "Invalid form."})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{"unsupported_grant_type", "Only the authorization_code grant is supported."})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	oerr := &oauthError{}
+	if errors.As(err, &oerr) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		writeOAuthJSON(w, http.StatusUnauthorized, oerr)
+		return
+	}
+	if err != nil {
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{"server_error", err.Error()})
+		return
+	}
+
+	code, err := cfg.db.UseOAuthCode(r.Context(), auth.HashRefreshToken(r.PostForm.Get("code")))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{"invalid_grant", "Invalid, expired or used code."})
+		return
+	}
+	if err != nil {
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{"server_error", err.Error()})
+		return
+	}
+	if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{"invalid_grant", "Code issued to another client or redirect URI."})
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{"invalid_grant", "Invalid code verifier."})
+		return
+	}
+
+	grant, err := cfg.db.CreateOAuthGrant(r.Context(), database.CreateOAuthGrantParams{
+		ClientID: client.ID,
+		UserID:   code.UserID,
+		Scopes:   code.Scopes,
+	})
+	if err != nil {
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{"server_error", err.Error()})
+		return
+	}
+	token, err := cfg.keys.MakeOAuthJWT(code.UserID, client.ID.String(), grant.ID, grant.Scopes, oauthAccessTokenDuration)
+	if err != nil {
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{"server_error", err.Error()})
+		return
+	}
+
+	type Res struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}
+	writeOAuthJSON(w, http.StatusOK, Res{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oauthAccessTokenDuration.Seconds()),
+		Scope:       strings.Join(grant.Scopes, " "),
+	})
+}
+
+// handleOAuthRevoke revokes the grant of an access token (RFC 7009).
+// Unknown and expired tokens are not an error, the client wanted them
+// unusable and they are.
+func (cfg *apiConfig) handleOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{"invalid_request", "Invalid form."})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	oerr := &oauthError{}
+	if errors.As(err, &oerr) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		writeOAuthJSON(w, http.StatusUnauthorized, oerr)
+		return
+	}
+	if err != nil {
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{"server_error", err.Error()})
+		return
+	}
+
+	claims, err := cfg.keys.ParseOAuthJWT(r.PostForm.Get("token"))
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if claims.ClientID != client.ID.String() {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{"unauthorized_client", "Token issued to another client."})
+		return
+	}
+	grantID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err = cfg.db.RevokeClientOAuthGrant(r.Context(), database.RevokeClientOAuthGrantParams{
+		ID:       grantID,
+		ClientID: client.ID,
+	})
+	if err != nil {
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{"server_error", err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+const maxClientNameLength = 50
+
+// handlePostOAuthClient registers a third party app. Confidential clients,
+// running on a server, get a secret; public ones, like mobile apps, rely
+// on PKCE alone.
+func (cfg *apiConfig) handlePostOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxClientNameLength {
+		http.Error(w, `{"error":"Not correct app name."}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.RedirectURIs) == 0 || len(req.RedirectURIs) > maxRedirectURIs {
+		http.Error(w, fmt.Sprintf(`{"error":"Between 1 and %d redirect URIs are needed."}`, maxRedirectURIs), http.StatusBadRequest)
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if err = validateRedirectURI(uri); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret, secretHash := "", ""
+	if req.Confidential {
+		if secret, err = auth.MakeRefreshToken(); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		secretHash = auth.HashRefreshToken(secret)
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         req.Name,
+		SecretHash:   secretHash,
+		RedirectUris: req.RedirectURIs,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// The secret is only stored hashed, so it is only ever shown here.
+	response := oauthClientFromDB(client)
+	response.Secret = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	clients, err := cfg.db.GetOAuthClientsByOwner(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	response := make([]OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, oauthClientFromDB(client))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDeleteOAuthClient removes an app, and with it every grant users
+// gave it.
+func (cfg *apiConfig) handleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	clientID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct client id."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetOAuthGrants lists the apps the user gave access to.
+func (cfg *apiConfig) handleGetOAuthGrants(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	grants, err := cfg.db.GetUserOAuthGrants(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	response := make([]OAuthGrant, 0, len(grants))
+	for _, grant := range grants {
+		response = append(response, OAuthGrant{
+			ID:         grant.ID,
+			CreatedAt:  grant.CreatedAt,
+			ClientID:   grant.ClientID,
+			ClientName: grant.ClientName,
+			Scopes:     grant.Scopes,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDeleteOAuthGrant revokes the access of an app. Its access tokens
+// stop working right away.
+func (cfg *apiConfig) handleDeleteOAuthGrant(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	grantID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct grant id."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.RevokeOAuthGrant(r.Context(), database.RevokeOAuthGrantParams{
+		ID:     grantID,
+		UserID: userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func oauthClientFromDB(c database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           c.ID,
+		CreatedAt:    c.CreatedAt,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Confidential: c.SecretHash != "",
+	}
+}
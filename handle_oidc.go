@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/oidc"
+	"github.com/google/uuid"
+)
+
+var (
+	errIdentityTaken         = errors.New("This account of the provider is linked to another user.")
+	errProviderEmail         = errors.New("The provider did not verify your email.")
+	errUnverifiedLocalEmail  = errors.New("An account uses this email, log in with your password and link the provider from it.")
+	errOIDCLoginNotAvailable = errors.New("Login with an external provider is not configured.")
+)
+
+// newOIDCProvider returns nil when no provider is configured.
+func newOIDCProvider(issuer, clientID, clientSecret, publicURL string) *oidc.Provider {
+	if issuer == "" {
+		return nil
+	}
+	return oidc.New(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  publicURL + backPath + "auth/oidc/callback",
+	})
+}
+
+// oidcStateCookie binds a pending login to the browser that started it, so
+// nobody can finish their own login, or link, in someone else's browser.
+const oidcStateCookie = "oidc_state"
+
+// startOIDCLogin records a pending login and returns the provider URL to
+// send the user to. linkUserID is set when a signed in user links the
+// provider to their account.
+func (cfg *apiConfig) startOIDCLogin(w http.ResponseWriter, r *http.Request, linkUserID uuid.NullUUID) (string, error) {
+	ctx := r.Context()
+	values := [3]string{}
+	for i := range values {
+		v, err := auth.MakeRefreshToken()
+		if err != nil {
+			return "", err
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	if err := cfg.db.DeleteExpiredOIDCStates(ctx); err != nil {
+		log.Printf("Failed to delete expired OIDC states: %v", err)
+	}
+	err := cfg.db.CreateOIDCState(ctx, database.CreateOIDCStateParams{
+		StateHash:    auth.HashRefreshToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().UTC().Add(oidcStateDuration),
+	})
+	if err != nil {
+		return "", err
+	}
+	u, err := cfg.oidc.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, cfg.oidcCookie(auth.HashRefreshToken(state), int(oidcStateDuration.Seconds())))
+	return u, nil
+}
+
+// oidcCookie returns the state cookie with value, or one deleting it when
+// maxAge is negative. Lax lets it come along on the redirect back from the
+// provider.
+func (cfg *apiConfig) oidcCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     backPath + "auth/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.publicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (cfg *apiConfig) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidc == nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errOIDCLoginNotAvailable), http.StatusNotFound)
+		return
+	}
+	u, err := cfg.startOIDCLogin(w, r, uuid.NullUUID{})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// handleOIDCLink answers with the provider URL instead of redirecting, the
+// request carries a bearer token so it does not come from a plain link. The
+// browser making it gets the state cookie, the URL works in no other.
+func (cfg *apiConfig) handleOIDCLink(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	if cfg.oidc == nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errOIDCLoginNotAvailable), http.StatusNotFound)
+		return
+	}
+	u, err := cfg.startOIDCLogin(w, r, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadGateway)
+		return
+	}
+
+	type Res struct {
+		URL string `json:"url"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(Res{URL: u}); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidc == nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errOIDCLoginNotAvailable), http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+
+	stateHash := auth.HashRefreshToken(q.Get("state"))
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+		http.Error(w, `{"error":"Login was not started in this browser."}`, http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, cfg.oidcCookie("", -1))
+
+	state, err := cfg.db.UseOIDCState(r.Context(), stateHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Invalid or expired login."}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if q.Get("error") != "" {
+		http.Error(w, `{"error":"The provider did not sign you in."}`, http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := cfg.oidc.Exchange(r.Context(), q.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		http.Error(w, `{"error":"The provider did not sign you in."}`, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := cfg.oidcUser(r.Context(), state, claims)
+	switch {
+	case errors.Is(err, errIdentityTaken), errors.Is(err, errUnverifiedLocalEmail):
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusConflict)
+		return
+	case errors.Is(err, errProviderEmail):
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	cfg.completeLogin(w, r, user, defaultExpSeconds*time.Second)
+}
+
+// oidcUser returns the user signed in as claims. Identities of the provider
+// already seen map to their user. New ones are linked to the user linking
+// them, else to the user with the same email, as long as both the provider
+// and we verified it, else to a new user.
+func (cfg *apiConfig) oidcUser(ctx context.Context, state database.OidcState, claims oidc.Claims) (database.User, error) {
+	identity, err := cfg.db.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Issuer:  cfg.oidc.Issuer(),
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		if state.LinkUserID.Valid && state.LinkUserID.UUID != identity.UserID {
+			return database.User{}, errIdentityTaken
+		}
+		return cfg.db.GetUserWithID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if state.LinkUserID.Valid {
+		return cfg.linkIdentity(ctx, cfg.db, state.LinkUserID.UUID, claims)
+	}
+
+	if !claims.EmailVerified || claims.Email == "" {
+		return database.User{}, errProviderEmail
+	}
+	user, err := cfg.db.GetUser(ctx, claims.Email)
+	if err == nil {
+		// Linking to an unverified account would hand the session of the
+		// provider account to whoever registered its email here first.
+		if !user.EmailVerifiedAt.Valid {
+			return database.User{}, errUnverifiedLocalEmail
+		}
+		return cfg.linkIdentity(ctx, cfg.db, user.ID, claims)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	// Users created here have no usable password until they reset it.
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	user, err = qtx.CreateUser(ctx, database.CreateUserParams{
+		Email:          claims.Email,
+		HashedPassword: hashedPassword,
+		Username:       generatedUsername(),
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if _, err = qtx.VerifyUserEmail(ctx, database.VerifyUserEmailParams{ID: user.ID, Email: user.Email}); err != nil {
+		return database.User{}, err
+	}
+	if user, err = cfg.linkIdentity(ctx, qtx, user.ID, claims); err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (cfg *apiConfig) linkIdentity(ctx context.Context, db *database.Queries, userID uuid.UUID, claims oidc.Claims) (database.User, error) {
+	_, err := db.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Issuer:  cfg.oidc.Issuer(),
+		Subject: claims.Subject,
+		UserID:  userID,
+		Email:   claims.Email,
+	})
+	if isUniqueViolation(err) {
+		return database.User{}, errIdentityTaken
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	return db.GetUserWithID(ctx, userID)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/mailer"
+)
+
+const (
+	resetRequestEmail = "reset_email"
+	resetRequestIP    = "reset_ip"
+)
+
+// Every reset request counts as an attempt, none is taken back, so nobody
+// can flood an inbox or the mail server with them.
+var (
+	resetEmailLimit = auth.LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Minute,
+		LockoutAfter:    6,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+	resetIPLimit = auth.LockoutPolicy{
+		FreeAttempts:    10,
+		BaseDelay:       time.Minute,
+		LockoutAfter:    30,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+// handleForgotPassword answers the same whether or not the email belongs
+// to a user, and mails the reset token in the background so the response
+// time does not tell either. Requests are limited per email, known or not,
+// and per address.
+func (cfg *apiConfig) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type Req struct {
+		Email string `json:"email"`
+	}
+	req := Req{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	err := cfg.beginAttempt(r.Context(), []attemptKey{
+		{kind: resetRequestEmail, key: strings.ToLower(req.Email), policy: resetEmailLimit},
+		{kind: resetRequestIP, key: clientIP(r), policy: resetIPLimit},
+	})
+	var locked *attemptLockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", locked.retryAfter())
+		http.Error(w, `{"error":"Too many reset requests, try again later."}`, http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	go func(email string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := cfg.sendPasswordReset(ctx, email); err != nil {
+			log.Printf("Failed to send password reset: %v", err)
+		}
+	}(req.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"message":"If an account uses this email, a reset token was sent to it."}`))
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := cfg.db.GetUser(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// A token sent a moment ago is likely still on its way.
+	recent, err := cfg.db.HasRecentPasswordReset(ctx, database.HasRecentPasswordResetParams{
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC().Add(-passwordResetCooldown),
+	})
+	if err != nil || recent {
+		return err
+	}
+
+	// Reset tokens are random and stored hashed the same way refresh
+	// tokens are.
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.db.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		TokenHash: auth.HashRefreshToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\nYour reset token is:\n\n%s\n\nSend it with your new password to POST %s%spassword/reset. It expires in %s and works once.\nIf you did not ask for it, ignore this email.\n",
+			token, cfg.publicURL, backPath, passwordResetDuration),
+	})
+}
+
+// handleResetPassword sets a new password and signs the user out of every
+// session, so whoever knew the old password loses access too.
+func (cfg *apiConfig) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	type Req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	req := Req{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		http.Error(w, `{"error":"No password on request."}`, http.StatusBadRequest)
+		return
+	}
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	reset, err := qtx.UsePasswordReset(r.Context(), auth.HashRefreshToken(req.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Invalid or expired reset token."}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	err = qtx.SetNewPassword(r.Context(), database.SetNewPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             reset.UserID,
+	})
+	if err == nil {
+		err = qtx.RevokeUserRefreshTokens(r.Context(), reset.UserID)
+	}
+	if err == nil {
+		err = qtx.DeletePasswordResets(r.Context(), reset.UserID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// recordingMailer keeps the messages it is asked to send.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestForgotPasswordRateLimited(t *testing.T) {
+	queries := []string{}
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		queries = append(queries, name)
+		return attemptFailureResult(args, int64(resetEmailLimit.LockoutAfter), time.Now().UTC()), nil
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email":"Victim@example.com"}`))
+	w := httptest.NewRecorder()
+	cfg.handleForgotPassword(w, r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	for _, name := range queries {
+		if name != "LockAttemptFailure" {
+			t.Errorf("unexpected query %s", name)
+		}
+	}
+}
+
+func TestForgotPasswordCountsRequests(t *testing.T) {
+	var mu sync.Mutex
+	recorded := map[string]string{}
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch name {
+		case "LockAttemptFailure":
+			return attemptFailureResult(args, 0, time.Now().UTC().Add(-time.Minute)), nil
+		case "RecordAttemptFailure":
+			recorded[args[0].(string)] = args[1].(string)
+			return attemptFailureResult(args, 1, time.Now().UTC()), nil
+		}
+		return fakeResult{columns: []string{"id"}}, nil
+	})
+	cfg.mailer = &recordingMailer{}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email":"Victim@example.com"}`))
+	w := httptest.NewRecorder()
+	cfg.handleForgotPassword(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if recorded[resetRequestEmail] != "victim@example.com" || recorded[resetRequestIP] != "192.0.2.1" {
+		t.Fatalf("recorded = %v", recorded)
+	}
+}
+
+func TestSendPasswordReset(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "user@example.com", Username: "user", Role: roleUser}
+	tests := []struct {
+		name     string
+		users    []database.User
+		recent   bool
+		wantMail bool
+	}{
+		{name: "Known email", users: []database.User{user}, wantMail: true},
+		{name: "Token sent a moment ago", users: []database.User{user}, recent: true},
+		{name: "Unknown email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+				switch name {
+				case "GetUser":
+					return userResult(tt.users...), nil
+				case "HasRecentPasswordReset":
+					return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{tt.recent}}}, nil
+				case "CreatePasswordReset":
+					created = true
+					return fakeResult{}, nil
+				}
+				t.Errorf("unexpected query %s", name)
+				return fakeResult{}, nil
+			})
+			mail := &recordingMailer{}
+			cfg.mailer = mail
+
+			if err := cfg.sendPasswordReset(context.Background(), "user@example.com"); err != nil {
+				t.Fatal(err)
+			}
+			if created != tt.wantMail || (len(mail.sent) == 1) != tt.wantMail {
+				t.Fatalf("created = %v, sent %d mails", created, len(mail.sent))
+			}
+			if tt.wantMail && mail.sent[0].To != user.Email {
+				t.Errorf("mail sent to %s", mail.sent[0].To)
+			}
+		})
+	}
+}
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		if name != "UsePasswordReset" {
+			t.Errorf("unexpected query %s", name)
+		}
+		return fakeResult{columns: []string{"token_hash", "user_id", "created_at", "expires_at", "used_at"}}, nil
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/password/reset", strings.NewReader(`{"token":"nope","password":"new password"}`))
+	w := httptest.NewRecorder()
+	cfg.handleResetPassword(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+const maxDisplayNameLength = 50
+const maxBioLength = 160
+const maxLocationLength = 30
+const maxURLLength = 200
+
+func (cfg *apiConfig) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil || hidden.has(user.ID) {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	profile, err := cfg.publicUser(r.Context(), user)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handlePatchProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	// Fields left out of the request keep their current value.
+	type Req struct {
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		AvatarURL   *string `json:"avatar_url"`
+		Location    *string `json:"location"`
+		Website     *string `json:"website"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	params := database.UpdateUserProfileParams{
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+		Location:    user.Location,
+		Website:     user.Website,
+		ID:          user.ID,
+	}
+	if req.DisplayName != nil {
+		params.DisplayName = *req.DisplayName
+	}
+	if req.Bio != nil {
+		params.Bio = *req.Bio
+	}
+	if req.AvatarURL != nil {
+		params.AvatarUrl = *req.AvatarURL
+	}
+	if req.Location != nil {
+		params.Location = *req.Location
+	}
+	if req.Website != nil {
+		params.Website = *req.Website
+	}
+
+	if err = validateProfile(params); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	user, err = cfg.db.UpdateUserProfile(r.Context(), params)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := cfg.publicUser(r.Context(), user)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	profile, err := cfg.publicUser(r.Context(), user)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) publicUser(ctx context.Context, user database.User) (PublicUser, error) {
+	counts, err := cfg.db.GetFollowCounts(ctx, user.ID)
+	if err != nil {
+		return PublicUser{}, err
+	}
+
+	return PublicUser{
+		ID:             user.ID,
+		CreatedAt:      user.CreatedAt,
+		Username:       user.Username,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarURL:      user.AvatarUrl,
+		Location:       user.Location,
+		Website:        user.Website,
+		IsRed:          user.IsChirpyRed,
+		FollowerCount:  counts.Followers,
+		FollowingCount: counts.Following,
+	}, nil
+}
+
+func validateProfile(p database.UpdateUserProfileParams) error {
+	if utf8.RuneCountInString(p.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("Too long display name")
+	}
+	if utf8.RuneCountInString(p.Bio) > maxBioLength {
+		return fmt.Errorf("Too long bio")
+	}
+	if utf8.RuneCountInString(p.Location) > maxLocationLength {
+		return fmt.Errorf("Too long location")
+	}
+	if err := validateProfileURL(p.AvatarUrl); err != nil {
+		return fmt.Errorf("Not correct avatar url")
+	}
+	if err := validateProfileURL(p.Website); err != nil {
+		return fmt.Errorf("Not correct website")
+	}
+	return nil
+}
+
+// validateProfileURL accepts empty strings, to clear a field, and absolute
+// http or https URLs.
+func validateProfileURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(raw) > maxURLLength {
+		return fmt.Errorf("url too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be http or https")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+// reactionEmojis are the reactions chirps accept.
+var reactionEmojis = map[string]struct{}{
+	"👍":  {},
+	"❤️": {},
+	"😂":  {},
+	"😮":  {},
+	"😢":  {},
+	"🎉":  {},
+}
+
+// reactableChirp returns the chirp with the id of the path of r when viewerID
+// can see it.
+func (cfg *apiConfig) reactableChirp(r *http.Request, viewerID uuid.UUID) (database.Chirp, error) {
+	chirpID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if hidden.has(chirp.UserID) {
+		return database.Chirp{}, fmt.Errorf("chirp of hidden user %s", chirp.UserID)
+	}
+	return chirp, nil
+}
+
+func (cfg *apiConfig) handlePostReaction(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		Emoji string `json:"emoji"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+	if _, ok := reactionEmojis[req.Emoji]; !ok {
+		http.Error(w, `{"error":"Not a supported reaction."}`, http.StatusBadRequest)
+		return
+	}
+
+	chirp, err := cfg.reactableChirp(r, userID)
+	if err != nil {
+		http.Error(w, `{"error":"Chirp not found."}`, http.StatusNotFound)
+		return
+	}
+
+	added, err := cfg.db.AddReaction(r.Context(), database.AddReactionParams{
+		ChirpID: chirp.ID,
+		UserID:  userID,
+		Emoji:   req.Emoji,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	// Reacting again with the same emoji changes nothing, and notifies
+	// nobody a second time.
+	if added > 0 {
+		cfg.notifier.Notify(notificationJob{
+			UserID:  chirp.UserID,
+			ActorID: userID,
+			Kind:    notificationReaction,
+			ChirpID: chirp.ID,
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleDeleteReaction(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	chirpID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct chirp id."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.RemoveReaction(r.Context(), database.RemoveReactionParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+		Emoji:   r.PathValue("emoji"),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleGetReactions(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	chirp, err := cfg.reactableChirp(r, viewerID)
+	if err != nil {
+		http.Error(w, `{"error":"Chirp not found."}`, http.StatusNotFound)
+		return
+	}
+
+	rows, err := cfg.db.GetReactionCounts(r.Context(), chirp.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	reactions := make([]ReactionCount, 0, len(rows))
+	for _, row := range rows {
+		reactions = append(reactions, ReactionCount{Emoji: row.Emoji, Count: row.Count})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(reactions); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+// A session is a refresh token family: it starts at login and every refresh
+// moves it on to a new token. Ending one revokes its refresh tokens, access
+// tokens already handed out keep working until they expire.
+
+// handleGetSessions lists the sessions of the user that can still refresh.
+func (cfg *apiConfig) handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := cfg.db.ListUserSessions(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	response := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, Session{
+			ID:         session.FamilyID,
+			StartedAt:  session.StartedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IP:         session.Ip,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	sessionID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct session id."}`, http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeUserRefreshTokenFamily(r.Context(), database.RevokeUserRefreshTokenFamilyParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, `{"error":"Session not found."}`, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeAllSessions logs the user out everywhere, including the
+// session making the request.
+func (cfg *apiConfig) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	if err = cfg.db.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
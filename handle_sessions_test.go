@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+func TestGetSessions(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		if name != "ListUserSessions" || args[0] != userID.String() {
+			t.Errorf("unexpected query %s %v", name, args)
+		}
+		return fakeResult{
+			columns: []string{"family_id", "user_agent", "ip", "last_used_at", "expires_at", "started_at"},
+			rows: [][]driver.Value{
+				{sessionID.String(), "curl/8.0", "203.0.113.7", started.Add(time.Hour), started.Add(24 * time.Hour), started},
+			},
+		}, nil
+	})
+
+	w := httptest.NewRecorder()
+	cfg.handleGetSessions(w, authorizedRequest(t, cfg, http.MethodGet, "/api/sessions", userID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	sessions := []Session{}
+	if err := json.NewDecoder(w.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	want := Session{
+		ID:         sessionID,
+		StartedAt:  started,
+		LastUsedAt: started.Add(time.Hour),
+		ExpiresAt:  started.Add(24 * time.Hour),
+		UserAgent:  "curl/8.0",
+		IP:         "203.0.113.7",
+	}
+	if len(sessions) != 1 || sessions[0] != want {
+		t.Fatalf("sessions = %+v, want [%+v]", sessions, want)
+	}
+}
+
+func TestGetSessionsUnauthorized(t *testing.T) {
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		t.Errorf("unexpected query %s", name)
+		return fakeResult{}, nil
+	})
+	w := httptest.NewRecorder()
+	cfg.handleGetSessions(w, httptest.NewRequest(http.MethodGet, "/api/sessions", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+	tests := []struct {
+		name     string
+		id       string
+		affected int64
+		want     int
+	}{
+		{name: "Own session", id: sessionID.String(), affected: 3, want: http.StatusNoContent},
+		{name: "Unknown or other user's session", id: sessionID.String(), affected: 0, want: http.StatusNotFound},
+		{name: "Invalid id", id: "nope", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+				if name != "RevokeUserRefreshTokenFamily" || args[0] != userID.String() || args[1] != sessionID.String() {
+					t.Errorf("unexpected query %s %v", name, args)
+				}
+				return fakeResult{affected: tt.affected}, nil
+			})
+			r := authorizedRequest(t, cfg, http.MethodDelete, "/api/sessions/"+tt.id, userID)
+			r.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+			cfg.handleDeleteSession(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	userID := uuid.New()
+	revoked := false
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		if name != "RevokeUserRefreshTokens" || args[0] != userID.String() {
+			t.Errorf("unexpected query %s %v", name, args)
+		}
+		revoked = true
+		return fakeResult{}, nil
+	})
+	w := httptest.NewRecorder()
+	cfg.handleRevokeAllSessions(w, authorizedRequest(t, cfg, http.MethodPost, "/api/sessions/revoke-all", userID))
+	if w.Code != http.StatusNoContent || !revoked {
+		t.Fatalf("status = %d, revoked = %v", w.Code, revoked)
+	}
+}
+
+func TestSanitizeUserAgent(t *testing.T) {
+	if got := sanitizeUserAgent("Mozilla/5.0 \xff\xfe(X11)\x00"); got != "Mozilla/5.0 (X11)" {
+		t.Errorf("invalid bytes: got %q", got)
+	}
+
+	long := strings.Repeat("a", maxUserAgentLength-1) + "é"
+	got := sanitizeUserAgent(long)
+	if len(got) > maxUserAgentLength || !utf8.ValidString(got) {
+		t.Errorf("long agent: got %d bytes, valid %v", len(got), utf8.ValidString(got))
+	}
+	if got != strings.Repeat("a", maxUserAgentLength-1) {
+		t.Errorf("long agent cut in the wrong place: %q", got[len(got)-3:])
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "[2001:db8::1]:5555"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := clientIP(r); got != "2001:db8::1" {
+		t.Errorf("clientIP = %q", got)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const defaultSuggestions = 10
+
+func (cfg *apiConfig) handleGetSuggestions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	limit := defaultSuggestions
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			http.Error(w, `{"error":"Not correct limit."}`, http.StatusBadRequest)
+			return
+		}
+		if limit > maxStoredSuggestions {
+			limit = maxStoredSuggestions
+		}
+	}
+
+	type candidate struct {
+		userID         uuid.UUID
+		score          float64
+		mutualCount    int32
+		sharedTagCount int32
+		reason         string
+	}
+	candidates := []candidate{}
+
+	rows, err := cfg.db.GetUserSuggestions(r.Context(), database.GetUserSuggestionsParams{
+		UserID:     userID,
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	for _, row := range rows {
+		// Every stored suggestion has mutual follows or shared hashtags.
+		reason := "shared_interests"
+		if row.MutualCount > 0 {
+			reason = "followed_by_people_you_follow"
+		}
+		candidates = append(candidates, candidate{
+			userID:         row.SuggestedID,
+			score:          row.Score,
+			mutualCount:    row.MutualCount,
+			sharedTagCount: row.SharedTagCount,
+			reason:         reason,
+		})
+	}
+
+	// Users who follow nobody and chirped no hashtags yet, like those who
+	// just signed up, get the most popular accounts instead.
+	if len(candidates) == 0 {
+		popular, err := cfg.db.GetPopularUsers(r.Context(), database.GetPopularUsersParams{
+			ActiveSince: time.Now().UTC().Add(-suggestionActivityWindow),
+			UserID:      userID,
+			MaxResults:  int32(limit),
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		for _, row := range popular {
+			candidates = append(candidates, candidate{
+				userID: row.ID,
+				score:  suggestionScore(0, 0, row.RecentChirps) + float64(row.FollowerCount),
+				reason: "popular",
+			})
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(candidates))
+	for _, c := range candidates {
+		user, err := cfg.db.GetUserWithID(r.Context(), c.userID)
+		if err != nil {
+			continue
+		}
+		profile, err := cfg.publicUser(r.Context(), user)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		suggestions = append(suggestions, Suggestion{
+			User:               profile,
+			Score:              c.score,
+			Reason:             c.reason,
+			MutualCount:        c.mutualCount,
+			SharedHashtagCount: c.sharedTagCount,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(suggestions); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+func (cfg *apiConfig) handleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	newChirps, err := cfg.timeline.Read(r.Context(), userID, p)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	hidden, err := cfg.hiddenUsers(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[Chirp]{Items: make([]Chirp, 0, len(newChirps))}
+	for _, chirp := range newChirps {
+		if hidden.has(chirp.UserID) {
+			continue
+		}
+		page.Items = append(page.Items, chirpFromDB(chirp))
+	}
+	if len(newChirps) > 0 {
+		page.NextCursor = p.nextCursor(len(newChirps), newChirps[len(newChirps)-1].CreatedAt, newChirps[len(newChirps)-1].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
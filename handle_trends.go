@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handleGetTrends(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "1h"
+	}
+	if _, ok := trendWindows[window]; !ok {
+		http.Error(w, `{"error":"Not correct window."}`, http.StatusBadRequest)
+		return
+	}
+
+	trends, ok := cfg.trends.Trends(window)
+	if !ok {
+		trends = Trends{Window: window, Trends: []Trend{}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(trends); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetTrendSuppressions(w http.ResponseWriter, r *http.Request) {
+	rows, err := cfg.db.GetTrendSuppressions(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	suppressions := make([]TrendSuppression, 0, len(rows))
+	for _, row := range rows {
+		suppression := TrendSuppression{
+			Term:      row.Term,
+			CreatedAt: row.CreatedAt,
+		}
+		if row.CreatedBy.Valid {
+			suppression.CreatedBy = &row.CreatedBy.UUID
+		}
+		suppressions = append(suppressions, suppression)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(suppressions); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handlePostTrendSuppression(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		Term string `json:"term"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+	term := normalizeTrendTerm(req.Term)
+	if term == "" {
+		http.Error(w, `{"error":"No term on request."}`, http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.db.CreateTrendSuppression(r.Context(), database.CreateTrendSuppressionParams{
+		Term:      term,
+		CreatedBy: uuid.NullUUID{UUID: userID, Valid: true},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	cfg.refreshTrends()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleDeleteTrendSuppression(w http.ResponseWriter, r *http.Request) {
+	if _, err := cfg.authenticate(r); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	err := cfg.db.DeleteTrendSuppression(r.Context(), normalizeTrendTerm(r.PathValue("term")))
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	cfg.refreshTrends()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshTrends recomputes trends right away so suppression changes don't
+// wait for the next aggregator run.
+func (cfg *apiConfig) refreshTrends() {
+	go func() {
+		if err := cfg.trends.refresh(context.Background()); err != nil {
+			log.Printf("Failed to refresh trends: %v", err)
+		}
+	}()
+}
+
+func normalizeTrendTerm(term string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(term), "#"))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+func (cfg *apiConfig) handleGetUserByHandle(w http.ResponseWriter, r *http.Request) {
+	handle := parseHandle(r.PathValue("handle"))
+
+	viewerID, err := cfg.viewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+	hidden, err := cfg.hiddenUsers(r.Context(), viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	user, redirected, err := cfg.userByHandle(r.Context(), handle)
+	if err != nil || hidden.has(user.ID) {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+	if redirected {
+		http.Redirect(w, r, fmt.Sprintf("%susers/by-handle/%s", backPath, user.Username), http.StatusMovedPermanently)
+		return
+	}
+
+	profile, err := cfg.publicUser(r.Context(), user)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handlePutUsername(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		Username string `json:"username"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+	req.Username = parseHandle(req.Username)
+
+	if err = validateUsername(req.Username); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+
+	// Changing the case of the current username is always allowed.
+	caseOnly := strings.EqualFold(user.Username, req.Username)
+	if !caseOnly && user.UsernameChangedAt.Valid {
+		next := user.UsernameChangedAt.Time.Add(usernameChangeCooldown)
+		if time.Now().UTC().Before(next) {
+			http.Error(w, fmt.Sprintf(`{"error":"Username can not be changed until %s."}`, next.Format(time.RFC3339)), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if !caseOnly {
+		if _, err = cfg.db.GetUserByUsername(r.Context(), req.Username); err == nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errUsernameTaken), http.StatusConflict)
+			return
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	updated, err := qtx.SetUsername(r.Context(), database.SetUsernameParams{
+		Username: req.Username,
+		ID:       userID,
+	})
+	if isUniqueViolation(err) {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errUsernameTaken), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if !caseOnly {
+		// The new owner of a handle takes it over from any previous owner's
+		// redirect, and the handle given up now redirects to this user.
+		err = claimUsername(r.Context(), qtx, req.Username, userID)
+		if errors.Is(err, errUsernameTaken) {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+		err = qtx.RecordUsernameHistory(r.Context(), database.RecordUsernameHistoryParams{
+			Username: user.Username,
+			UserID:   userID,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := cfg.publicUser(r.Context(), updated)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
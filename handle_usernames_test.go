@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestPutUsernameReleasedHandle(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name     string
+		reserved bool
+		wantCode int
+		claimed  bool
+	}{
+		{"within grace period", true, http.StatusConflict, false},
+		{"after grace period", false, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claimed := false
+			cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+				switch name {
+				case "GetUserWithID":
+					return userResult(database.User{ID: userID, Username: "alice"}), nil
+				case "GetUserByUsername":
+					return userResult(), nil
+				case "SetUsername":
+					return userResult(database.User{ID: userID, Username: "bob"}), nil
+				case "IsUsernameReserved":
+					if args[1] != userID.String() {
+						t.Errorf("reservation checked for %v, want %s", args[1], userID)
+					}
+					return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{tt.reserved}}}, nil
+				case "DeleteUsernameHistory":
+					claimed = true
+					return fakeResult{}, nil
+				case "RecordUsernameHistory":
+					return fakeResult{}, nil
+				case "GetFollowCounts":
+					return fakeResult{columns: []string{"followers", "following"}, rows: [][]driver.Value{{int64(0), int64(0)}}}, nil
+				}
+				t.Errorf("unexpected query %s %v", name, args)
+				return fakeResult{}, nil
+			})
+
+			r := authorizedRequest(t, cfg, http.MethodPut, "/api/users/me/username", userID)
+			r.Body = io.NopCloser(strings.NewReader(`{"username":"bob"}`))
+			w := httptest.NewRecorder()
+			cfg.handlePutUsername(w, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if claimed != tt.claimed {
+				t.Fatalf("claimed = %v, want %v", claimed, tt.claimed)
+			}
+		})
+	}
+}
+
+func TestPostUserReleasedHandle(t *testing.T) {
+	cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+		if name != "IsUsernameReserved" {
+			t.Errorf("unexpected query %s %v", name, args)
+		}
+		return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{true}}}, nil
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"email":"bob@example.com","password":"secret","username":"bob"}`))
+	w := httptest.NewRecorder()
+	cfg.handlePostUser(w, r)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+}
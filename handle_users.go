@@ -1,17 +1,35 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/MeMetoCoco3/goserver/internal/auth"
 	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+	"log"
 	"net/http"
+	"net/mail"
 )
 
+var errInvalidEmail = errors.New("Not valid email.")
+
+// validateEmail accepts a bare address only, "Name <address>" forms are
+// refused so the stored email is always the address itself.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errInvalidEmail
+	}
+	return nil
+}
+
 func (cfg *apiConfig) handlePostUser(w http.ResponseWriter, r *http.Request) {
 	type Req struct {
 		Email          string `json:"email"`
 		HashedPassword string `json:"password"`
+		Username       string `json:"username"`
 	}
 
 	req := Req{}
@@ -26,6 +44,30 @@ func (cfg *apiConfig) handlePostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = validateEmail(req.Email); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" {
+		req.Username = generatedUsername()
+	} else {
+		req.Username = parseHandle(req.Username)
+		if err = validateUsername(req.Username); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+			return
+		}
+		err = claimUsername(r.Context(), cfg.db, req.Username, uuid.Nil)
+		if errors.Is(err, errUsernameTaken) {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	hashedPassword, err := auth.HashPassword(req.HashedPassword)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
@@ -35,14 +77,29 @@ func (cfg *apiConfig) handlePostUser(w http.ResponseWriter, r *http.Request) {
 	userUpdated, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          req.Email,
 		HashedPassword: hashedPassword,
+		Username:       req.Username,
 	})
+	if isUniqueViolation(err) {
+		http.Error(w, `{"error":"Email or username already taken."}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if err = cfg.sendVerificationEmail(r.Context(), userUpdated.ID, userUpdated.Email); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", userUpdated.ID, err)
+	}
+
 	user := User{
-		ID:             userUpdated.ID,
-		CreatedAt:      userUpdated.CreatedAt,
-		UpdatedAt:      userUpdated.UpdatedAt,
-		Email:          userUpdated.Email,
-		HashedPassword: userUpdated.HashedPassword,
-		IsRed:          userUpdated.IsChirpyRed,
+		ID:            userUpdated.ID,
+		CreatedAt:     userUpdated.CreatedAt,
+		UpdatedAt:     userUpdated.UpdatedAt,
+		Email:         userUpdated.Email,
+		EmailVerified: userUpdated.EmailVerifiedAt.Valid,
+		Username:      userUpdated.Username,
+		Role:          userUpdated.Role,
+		IsRed:         userUpdated.IsChirpyRed,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -71,19 +128,18 @@ func (cfg *apiConfig) handlePutUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(req.HashedPassword)
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error1":"%s"}`, err), http.StatusInternalServerError)
+	if err = validateEmail(req.Email); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	hashedPassword, err := auth.HashPassword(req.HashedPassword)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error2": "%s"}`, err), http.StatusUnauthorized)
+		http.Error(w, fmt.Sprintf(`{"error1":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.authenticate(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error3":"%s"}`, err), http.StatusUnauthorized)
 		return
@@ -96,11 +152,23 @@ func (cfg *apiConfig) handlePutUser(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println("Pre Set everything")
 	if userUpdated.Email != req.Email {
-		cfg.db.SetNewEmail(r.Context(), database.SetNewEmailParams{
+		err = cfg.db.SetNewEmail(r.Context(), database.SetNewEmailParams{
 			Email: req.Email,
 			ID:    userID,
 		})
+		if isUniqueViolation(err) {
+			http.Error(w, `{"error":"Email already taken."}`, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			return
+		}
 		userUpdated.Email = req.Email
+		userUpdated.EmailVerifiedAt = sql.NullTime{}
+		if err = cfg.sendVerificationEmail(r.Context(), userID, req.Email); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", userID, err)
+		}
 	}
 	if userUpdated.HashedPassword != hashedPassword {
 		cfg.db.SetNewPassword(r.Context(), database.SetNewPasswordParams{
@@ -110,6 +178,12 @@ func (cfg *apiConfig) handlePutUser(w http.ResponseWriter, r *http.Request) {
 		userUpdated.HashedPassword = hashedPassword
 	}
 
+	counts, err := cfg.db.GetFollowCounts(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 
@@ -118,8 +192,12 @@ func (cfg *apiConfig) handlePutUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:      userUpdated.CreatedAt,
 		UpdatedAt:      userUpdated.UpdatedAt,
 		Email:          userUpdated.Email,
-		HashedPassword: userUpdated.HashedPassword,
+		EmailVerified:  userUpdated.EmailVerifiedAt.Valid,
+		Username:       userUpdated.Username,
+		Role:           userUpdated.Role,
 		IsRed:          userUpdated.IsChirpyRed,
+		FollowerCount:  counts.Followers,
+		FollowingCount: counts.Following,
 	}
 
 	if err = json.NewEncoder(w).Encode(user); err != nil {
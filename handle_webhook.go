@@ -39,6 +39,11 @@ func (cfg *apiConfig) handlerWebhook(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"Event not allowed."}`, http.StatusNotFound)
 		return
 	}
+	cfg.notifier.Notify(notificationJob{
+		UserID: params.Data.UserID,
+		Kind:   notificationChirpyRed,
+	})
+	cfg.webhooks.Enqueue(r.Context(), webhookUserUpgraded, params.Data.UserID, params.Data)
 
 	w.WriteHeader(http.StatusNoContent)
 
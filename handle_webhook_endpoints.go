@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/webhook"
+	"github.com/google/uuid"
+)
+
+var errWebhookNotFound = errors.New("Webhook not found.")
+
+func (cfg *apiConfig) handlePostWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	cfg.createWebhookEndpoint(w, r, false)
+}
+
+// handlePostGlobalWebhookEndpoint registers an endpoint receiving the
+// events of every user.
+func (cfg *apiConfig) handlePostGlobalWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	cfg.createWebhookEndpoint(w, r, true)
+}
+
+func (cfg *apiConfig) createWebhookEndpoint(w http.ResponseWriter, r *http.Request, global bool) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	type Req struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+	}
+	req := Req{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Failed to decode body."}`, http.StatusBadRequest)
+		return
+	}
+
+	if err = cfg.validateWebhookURL(req.URL); err != nil {
+		http.Error(w, `{"error":"Not correct url."}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.EventTypes) == 0 {
+		http.Error(w, `{"error":"No event types on request."}`, http.StatusBadRequest)
+		return
+	}
+	for _, event := range req.EventTypes {
+		if _, ok := webhookEventTypes[event]; !ok {
+			http.Error(w, fmt.Sprintf(`{"error":"Unknown event type %s."}`, event), http.StatusBadRequest)
+			return
+		}
+	}
+
+	count, err := cfg.db.CountWebhookEndpointsByUser(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if count >= maxWebhookEndpoints {
+		http.Error(w, `{"error":"Too many webhooks."}`, http.StatusBadRequest)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	endpoint, err := cfg.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:     userID,
+		Url:        req.URL,
+		Secret:     secret,
+		EventTypes: req.EventTypes,
+		IsGlobal:   global,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// The secret is only ever shown on creation.
+	response := webhookEndpointFromDB(endpoint)
+	response.Secret = endpoint.Secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleGetWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := cfg.db.GetWebhookEndpointsByUser(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	endpoints := make([]WebhookEndpoint, 0, len(rows))
+	for _, row := range rows {
+		endpoints = append(endpoints, webhookEndpointFromDB(row))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(endpoints); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (cfg *apiConfig) handleDeleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	endpoint, err := cfg.ownWebhookEndpoint(r, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusNotFound)
+		return
+	}
+
+	err = cfg.db.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpoint.ID,
+		UserID: userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	endpoint, err := cfg.ownWebhookEndpoint(r, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusNotFound)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := cfg.db.GetWebhookDeliveries(r.Context(), database.GetWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		CreatedAt:  p.Before,
+		ID:         p.BeforeID,
+		Limit:      p.Limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	page := Page[WebhookDelivery]{Items: make([]WebhookDelivery, 0, len(rows))}
+	for _, row := range rows {
+		page.Items = append(page.Items, webhookDeliveryFromDB(row))
+	}
+	if len(rows) > 0 {
+		page.NextCursor = p.nextCursor(len(rows), rows[len(rows)-1].CreatedAt, rows[len(rows)-1].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleRedeliverWebhook queues a delivery again, whatever its state, with
+// a fresh set of attempts.
+func (cfg *apiConfig) handleRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	endpoint, err := cfg.ownWebhookEndpoint(r, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusNotFound)
+		return
+	}
+
+	deliveryID, err := stringToUUID(r.PathValue("delivery_id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct delivery id."}`, http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := cfg.db.RedeliverWebhookDelivery(r.Context(), database.RedeliverWebhookDeliveryParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if err != nil {
+		http.Error(w, `{"error":"Delivery not found."}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(webhookDeliveryFromDB(delivery)); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ownWebhookEndpoint loads the endpoint of the request path, provided it
+// was registered by userID.
+func (cfg *apiConfig) ownWebhookEndpoint(r *http.Request, userID uuid.UUID) (database.WebhookEndpoint, error) {
+	endpointID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		return database.WebhookEndpoint{}, errWebhookNotFound
+	}
+	endpoint, err := cfg.db.GetWebhookEndpoint(r.Context(), endpointID)
+	if err != nil || endpoint.UserID != userID {
+		return database.WebhookEndpoint{}, errWebhookNotFound
+	}
+	return endpoint, nil
+}
+
+// validateWebhookURL accepts absolute https URLs, and http ones on dev.
+// Internal hosts given as an address or as localhost are refused here, the
+// dispatcher checks the addresses hostnames resolve to when it sends.
+func (cfg *apiConfig) validateWebhookURL(raw string) error {
+	if len(raw) > maxURLLength {
+		return fmt.Errorf("url too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && cfg.who == "dev")) {
+		return fmt.Errorf("url must be https")
+	}
+	if cfg.who == "dev" {
+		return nil
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); (err == nil && !webhook.AllowedAddr(addr)) || strings.EqualFold(host, "localhost") {
+		return fmt.Errorf("url must not point to an internal host")
+	}
+	return nil
+}
+
+func webhookEndpointFromDB(e database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:         e.ID,
+		CreatedAt:  e.CreatedAt,
+		URL:        e.Url,
+		EventTypes: e.EventTypes,
+		IsGlobal:   e.IsGlobal,
+	}
+}
+
+func webhookDeliveryFromDB(d database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:        d.ID,
+		CreatedAt: d.CreatedAt,
+		EventType: d.EventType,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		LastError: d.LastError,
+		Payload:   json.RawMessage(d.Payload),
+	}
+	if d.Status == deliveryPending {
+		delivery.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.LastAttemptAt.Valid {
+		delivery.LastAttemptAt = &d.LastAttemptAt.Time
+	}
+	if d.ResponseStatus.Valid {
+		delivery.ResponseStatus = &d.ResponseStatus.Int32
+	}
+	return delivery
+}
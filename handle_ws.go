@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/websocket"
+	"github.com/google/uuid"
+)
+
+// handleWebSocket upgrades authenticated clients to a WebSocket. Browsers
+// can not set headers on the handshake, so the access token may also come
+// as the access_token query parameter.
+func (cfg *apiConfig) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		token = r.URL.Query().Get("access_token")
+	}
+	userID, expiresAt, err := cfg.validateAccessToken(token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	conn.ReadTimeout = wsReadTimeout
+
+	client := &wsClient{
+		gateway:  cfg.gateway,
+		conn:     conn,
+		send:     make(chan []byte, wsSendBuffer),
+		done:     make(chan struct{}),
+		channels: map[string]struct{}{},
+	}
+	if err = client.authenticate(context.Background(), userID, expiresAt); err != nil {
+		client.close(websocket.CloseTryAgainLater, "failed to load user")
+		return
+	}
+	cfg.gateway.register(client)
+	go client.writeLoop()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			code := websocket.CloseGoingAway
+			if errors.Is(err, websocket.ErrMessageTooBig) {
+				code = websocket.CloseMessageTooBig
+			} else if errors.Is(err, websocket.ErrProtocol) || errors.Is(err, websocket.ErrUnmaskedFrame) {
+				code = websocket.CloseProtocolError
+			}
+			client.close(code, "")
+			return
+		}
+
+		msg := wsMessage{}
+		if err = json.Unmarshal(data, &msg); err != nil {
+			client.sendJSON(wsControl{Type: "error", Error: "Failed to decode message."})
+			continue
+		}
+		cfg.handleWebSocketMessage(client, msg)
+	}
+}
+
+func (cfg *apiConfig) handleWebSocketMessage(client *wsClient, msg wsMessage) {
+	ctx := context.Background()
+
+	switch msg.Type {
+	case "auth":
+		userID, expiresAt, err := cfg.validateAccessToken(msg.Token)
+		if err != nil {
+			client.sendJSON(wsControl{Type: "error", Error: err.Error()})
+			return
+		}
+		if userID != client.user() {
+			client.close(websocket.ClosePolicyViolation, "token of another user")
+			return
+		}
+		if err = client.authenticate(ctx, userID, expiresAt); err != nil {
+			client.sendJSON(wsControl{Type: "error", Error: err.Error()})
+			return
+		}
+		client.sendJSON(wsControl{Type: "authenticated"})
+
+	case "subscribe":
+		if err := cfg.checkChannel(ctx, client, msg.Channel); err != nil {
+			client.sendJSON(wsControl{Type: "error", Channel: msg.Channel, Error: err.Error()})
+			return
+		}
+		client.subscribe(msg.Channel)
+		client.sendJSON(wsControl{Type: "subscribed", Channel: msg.Channel})
+
+	case "unsubscribe":
+		client.unsubscribe(msg.Channel)
+		client.sendJSON(wsControl{Type: "unsubscribed", Channel: msg.Channel})
+
+	default:
+		client.sendJSON(wsControl{Type: "error", Error: "Unknown message type."})
+	}
+}
+
+// checkChannel returns an error unless client may subscribe to channel.
+func (cfg *apiConfig) checkChannel(ctx context.Context, client *wsClient, channel string) error {
+	switch {
+	case channel == wsChannelTimeline, channel == wsChannelNotifications:
+		return nil
+	case isRepliesChannel(channel):
+		chirpID, err := uuid.Parse(strings.TrimPrefix(channel, wsChannelRepliesPrefix))
+		if err != nil {
+			return errors.New("Not correct chirp id.")
+		}
+		chirp, err := cfg.db.GetChirp(ctx, chirpID)
+		if err != nil {
+			return errors.New("Chirp not found.")
+		}
+		blocked, err := cfg.isBlocked(ctx, client.user(), chirp.UserID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return errors.New("Chirp not found.")
+		}
+		return nil
+	default:
+		return errors.New("Unknown channel.")
+	}
+}
+
+func (cfg *apiConfig) validateAccessToken(token string) (uuid.UUID, time.Time, error) {
+	if token == "" {
+		return uuid.Nil, time.Time{}, auth.ErrNoTokenString
+	}
+	userID, err := cfg.keys.ValidateJWT(token)
+	if err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	expiresAt, err := auth.JWTExpiry(token)
+	if err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	return userID, expiresAt, nil
+}
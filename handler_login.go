@@ -1,72 +1,104 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/MeMetoCoco3/goserver/internal/auth"
 	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
 	"net/http"
 	"time"
 )
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 
-	u := User{}
+	type Req struct {
+		Email            string `json:"email"`
+		Password         string `json:"password"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+
+	req := Req{}
 	fmt.Println("LOGIN!")
-	err := json.NewDecoder(r.Body).Decode(&u)
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
 
-	if u.ExpiresInSeconds == 0 || u.ExpiresInSeconds > defaultExpSeconds {
-		u.ExpiresInSeconds = defaultExpSeconds
+	if req.ExpiresInSeconds == 0 || req.ExpiresInSeconds > defaultExpSeconds {
+		req.ExpiresInSeconds = defaultExpSeconds
 	}
 
-	user, err := cfg.db.GetUser(r.Context(), u.Email)
-	if err != nil {
-		http.Error(w, `{"error":"Incorrect email"}`, http.StatusUnauthorized)
+	user, err := cfg.checkLogin(r.Context(), req.Email, req.Password, clientIP(r))
+	var locked *attemptLockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", locked.retryAfter())
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, errLoginFailed):
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
 
-	err = auth.CheckPasswordHash(user.HashedPassword, u.HashedPassword)
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"Incorrect email or password, %s"}`, err), http.StatusUnauthorized)
+	cfg.completeLogin(w, r, user, time.Duration(req.ExpiresInSeconds)*time.Second)
+}
+
+// completeLogin finishes the first step of a login: users with two-factor
+// authentication get an MFA challenge, everyone else a session.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User, expiresIn time.Duration) {
+	totp, err := cfg.db.GetUserTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
+	if err == nil && totp.ConfirmedAt.Valid {
+		cfg.writeMFAChallenge(w, user.ID)
+		return
+	}
+
+	cfg.writeLogin(w, r, user, expiresIn)
+}
 
-	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Duration(u.ExpiresInSeconds))
+// writeLogin starts a session for user and answers with its tokens.
+func (cfg *apiConfig) writeLogin(w http.ResponseWriter, r *http.Request, user database.User, expiresIn time.Duration) {
+	token, err := cfg.keys.MakeJWT(user.ID, user.Role, expiresIn)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
-	refreshToken, err := auth.MakeRefreshToken()
+	refreshToken, err := issueRefreshToken(r, cfg.db, user.ID, uuid.New())
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-
-	u = User{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        token,
-		RefreshToken: refreshToken,
-		IsRed:        user.IsChirpyRed,
-	}
-	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
-	})
+	counts, err := cfg.db.GetFollowCounts(r.Context(), user.ID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
 
+	u := User{
+		ID:             user.ID,
+		CreatedAt:      user.CreatedAt,
+		UpdatedAt:      user.UpdatedAt,
+		Email:          user.Email,
+		EmailVerified:  user.EmailVerifiedAt.Valid,
+		Username:       user.Username,
+		Role:           user.Role,
+		Token:          token,
+		RefreshToken:   refreshToken,
+		IsRed:          user.IsChirpyRed,
+		FollowerCount:  counts.Followers,
+		FollowingCount: counts.Following,
+	}
 	if err = json.NewEncoder(w).Encode(&u); err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
@@ -1,45 +1,141 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"log"
 	"net/http"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
 )
 
+// handlerRefresh trades a refresh token for a new access token and a new
+// refresh token of the same family. Every refresh token works once: when a
+// rotated one comes back, it was stolen or leaked, so the whole family is
+// revoked and its holder, legitimate or not, has to log in again.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
-	fmt.Println(" ENTER REFRESH")
 	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
-	fmt.Printf("We got the token : %v \n", token)
-	tokenData, err := cfg.db.GetRefreshToken(r.Context(), string(token))
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Marking the token rotated only succeeds once, so concurrent refreshes
+	// with the same token can not both get a successor.
+	tokenData, err := qtx.RotateRefreshToken(r.Context(), auth.HashRefreshToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		if reused, err := cfg.detectRefreshTokenReuse(r.Context(), token); err != nil {
+			log.Printf("Failed to check refresh token reuse: %v", err)
+		} else if reused {
+			http.Error(w, `{"error":"Refresh token reused, session revoked."}`, http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, `{"error":"Couldn't get user for refresh token"}`, http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
-	fmt.Printf("We validated the token\n")
-	user, err := cfg.db.GetUserWithToken(r.Context(), tokenData.Token)
+
+	refreshToken, err := issueRefreshToken(r, qtx, tokenData.UserID, tokenData.FamilyID)
 	if err != nil {
-		http.Error(w, `{"error":"Couldn't get user for refresh token"}`, http.StatusUnauthorized)
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
 	}
-	fmt.Println("We got the user")
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour,
-	)
 
+	user, err := cfg.db.GetUserWithID(r.Context(), tokenData.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := cfg.keys.MakeJWT(user.ID, user.Role, defaultExpSeconds*time.Second)
 	if err != nil {
 		http.Error(w, `{"error":"Couldnt validate token."}`, http.StatusUnauthorized)
 		return
 	}
-	fmt.Println("We made the token!")
-	w.WriteHeader(http.StatusOK)
+
+	type Res struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(fmt.Sprintf(`{"token":"%s"}`, accessToken)))
-	return
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(Res{Token: accessToken, RefreshToken: refreshToken}); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// detectRefreshTokenReuse revokes the family of token when token was
+// already rotated, and reports whether it did.
+func (cfg *apiConfig) detectRefreshTokenReuse(ctx context.Context, token string) (bool, error) {
+	tokenData, err := cfg.db.GetRefreshToken(ctx, auth.HashRefreshToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !tokenData.RotatedAt.Valid {
+		return false, nil
+	}
+	return true, cfg.db.RevokeRefreshTokenFamily(ctx, tokenData.FamilyID)
+}
+
+// issueRefreshToken stores the digest of a new refresh token of userID in
+// familyID, along with the client of r, and returns the token. Logins start
+// new families with uuid.New().
+func issueRefreshToken(r *http.Request, db *database.Queries, userID, familyID uuid.UUID) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenDuration),
+		FamilyID:  familyID,
+		UserAgent: sanitizeUserAgent(r.UserAgent()),
+		Ip:        clientIP(r),
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// sanitizeUserAgent makes userAgent fit a TEXT column: Postgres refuses
+// invalid UTF-8 and NUL bytes, and the length is capped at
+// maxUserAgentLength bytes without splitting a character.
+func sanitizeUserAgent(userAgent string) string {
+	userAgent = strings.ReplaceAll(strings.ToValidUTF8(userAgent, ""), "\x00", "")
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+	end := maxUserAgentLength
+	for end > 0 && !utf8.RuneStart(userAgent[end]) {
+		end--
+	}
+	return userAgent[:end]
 }
@@ -13,7 +13,13 @@ func (cfg *apiConfig) handleRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = cfg.db.DeleteRefreshToken(r.Context(), string(token))
+	tokenData, err := cfg.db.DeleteRefreshToken(r.Context(), auth.HashRefreshToken(token))
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	// Logging out ends the session, so its earlier tokens go too.
+	err = cfg.db.RevokeRefreshTokenFamily(r.Context(), tokenData.FamilyID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
 		return
@@ -63,51 +63,31 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
-func TestValidateJWT(t *testing.T) {
-	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+func TestJWTExpiry(t *testing.T) {
+	keys, _ := NewKeyring(Key{}, nil, "secret")
+	validToken, _ := keys.MakeJWT(uuid.New(), "user", time.Minute)
 
-	tests := []struct {
-		name        string
-		tokenString string
-		tokenSecret string
-		wantUserID  uuid.UUID
-		wantErr     bool
-	}{
-		{
-			name:        "Valid token",
-			tokenString: validToken,
-			tokenSecret: "secret",
-			wantUserID:  userID,
-			wantErr:     false,
-		},
-		{
-			name:        "Invalid token",
-			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
-			wantUserID:  uuid.Nil,
-			wantErr:     true,
-		},
-		{
-			name:        "Wrong secret",
-			tokenString: validToken,
-			tokenSecret: "wrong_secret",
-			wantUserID:  uuid.Nil,
-			wantErr:     true,
-		},
+	got, err := JWTExpiry(validToken)
+	if err != nil {
+		t.Fatalf("JWTExpiry() error = %v", err)
+	}
+	if want := time.Now().Add(time.Minute); got.Before(want.Add(-5*time.Second)) || got.After(want.Add(5*time.Second)) {
+		t.Errorf("JWTExpiry() = %v, want about %v", got, want)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if gotUserID != tt.wantUserID {
-				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, tt.wantUserID)
-			}
-		})
+	if _, err = JWTExpiry("invalid.token.string"); err == nil {
+		t.Errorf("JWTExpiry() on invalid token error = nil, want error")
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	// sha256("abc") from FIPS 180-2.
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashRefreshToken("abc"); got != want {
+		t.Errorf("HashRefreshToken() = %v, want %v", got, want)
+	}
+	if HashRefreshToken("abc") == HashRefreshToken("abd") {
+		t.Errorf("HashRefreshToken() collides on different tokens")
 	}
 }
 
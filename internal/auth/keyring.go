@@ -0,0 +1,416 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownKey        = errors.New("unknown signing key")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrNoSigningKey      = errors.New("no signing key")
+	ErrUnexpectedSigning = errors.New("unexpected signing method")
+)
+
+// legacyKeyID identifies the shared HS256 secret. Tokens signed with it
+// carry no kid, and the secret is never published.
+const legacyKeyID = ""
+
+// Key is a key tokens are signed or verified with. Private is nil for keys
+// kept only to verify tokens signed before a rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// NewKey wraps an Ed25519 or RSA key, private or public. Its ID is the
+// RFC 7638 thumbprint of the public key.
+func NewKey(key any) (Key, error) {
+	k := Key{}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		k.Method = jwt.SigningMethodEdDSA
+		k.Private = key
+		k.Public = key.Public()
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+		k.Public = key
+	case *rsa.PrivateKey:
+		k.Method = jwt.SigningMethodRS256
+		k.Private = key
+		k.Public = &key.PublicKey
+	case *rsa.PublicKey:
+		k.Method = jwt.SigningMethodRS256
+		k.Public = key
+	default:
+		return Key{}, ErrUnsupportedKey
+	}
+
+	thumbprint, err := publicJWK(k.Public).thumbprint()
+	if err != nil {
+		return Key{}, err
+	}
+	k.ID = thumbprint
+	return k, nil
+}
+
+// LoadKey reads a PEM encoded PKCS #8, PKCS #1 or PKIX key from path.
+func LoadKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewKey(key)
+}
+
+// Keyring signs access tokens with a single key and verifies them with any
+// of its keys, so tokens issued before a key rotation stay valid until they
+// expire. The rotation goes: publish the new key as a verification key,
+// switch signing to it, then drop the old key once its tokens expired.
+type Keyring struct {
+	signing      Key
+	verification map[string]Key
+	hmacSecret   []byte
+}
+
+// NewKeyring signs with signing, or with hmacSecret when signing has no
+// private key. A non empty hmacSecret also verifies tokens without kid,
+// the ones issued before asymmetric keys were configured.
+func NewKeyring(signing Key, verification []Key, hmacSecret string) (*Keyring, error) {
+	k := &Keyring{
+		signing:      signing,
+		verification: map[string]Key{},
+		hmacSecret:   []byte(hmacSecret),
+	}
+	if signing.Private == nil {
+		if hmacSecret == "" {
+			return nil, ErrNoSigningKey
+		}
+		k.signing = Key{ID: legacyKeyID, Method: jwt.SigningMethodHS256}
+	} else {
+		k.verification[signing.ID] = signing
+	}
+	for _, key := range verification {
+		k.verification[key.ID] = key
+	}
+	return k, nil
+}
+
+// LoadKeyring builds a keyring from PEM files. With no signingKeyFile it
+// falls back to HS256 with hmacSecret.
+func LoadKeyring(signingKeyFile string, verificationKeyFiles []string, hmacSecret string) (*Keyring, error) {
+	signing := Key{}
+	if signingKeyFile != "" {
+		key, err := LoadKey(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.Private == nil {
+			return nil, fmt.Errorf("%s: %w", signingKeyFile, ErrNoSigningKey)
+		}
+		signing = key
+	}
+
+	verification := []Key{}
+	for _, path := range verificationKeyFiles {
+		key, err := LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+	return NewKeyring(signing, verification, hmacSecret)
+}
+
+// Claims are the claims of access tokens. Role is the role of the user
+// when the token was issued.
+type Claims struct {
+	Role string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// EmailClaims are the claims of email verification tokens. ID identifies
+// the verification, so a link can be used once.
+type EmailClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// OAuthClaims are the claims of access tokens issued to OAuth clients. ID
+// is the grant the token was issued under, revoking the grant revokes the
+// token.
+type OAuthClaims struct {
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id"`
+	jwt.RegisteredClaims
+}
+
+// HasScope reports whether scope is one of the space separated scopes of
+// the token.
+func (c OAuthClaims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Keyring) MakeJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	return k.sign(Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	})
+}
+
+// MakeEmailToken signs a token proving the owner of userID received a mail
+// sent to email.
+func (k *Keyring) MakeEmailToken(userID, id uuid.UUID, email string, expiresIn time.Duration) (string, error) {
+	return k.sign(EmailClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeEmailVerification),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        id.String(),
+		},
+	})
+}
+
+// MakeMFAToken signs a token proving userID passed the password step of a
+// login, to be exchanged with a second factor for access tokens.
+func (k *Keyring) MakeMFAToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return k.sign(jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeMFAChallenge),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		Subject:   userID.String(),
+	})
+}
+
+// MakeOAuthJWT signs an access token for clientID acting as userID. Its
+// issuer differs from the one of first party tokens, so ValidateJWT does
+// not accept it and routes opt in to OAuth tokens one scope at a time.
+func (k *Keyring) MakeOAuthJWT(userID uuid.UUID, clientID string, grantID uuid.UUID, scopes []string, expiresIn time.Duration) (string, error) {
+	return k.sign(OAuthClaims{
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeOAuthAccess),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        grantID.String(),
+		},
+	})
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	if k.signing.Private == nil {
+		return token.SignedString(k.hmacSecret)
+	}
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.Private)
+}
+
+func (k *Keyring) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := k.ParseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return id, nil
+}
+
+// ParseJWT validates tokenString and returns its claims.
+func (k *Keyring) ParseJWT(tokenString string) (Claims, error) {
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, k.keyFunc, jwt.WithIssuer(string(TokenTypeAccess)))
+	if err != nil {
+		return Claims{}, err
+	}
+	return claims, nil
+}
+
+// ParseEmailToken validates a token made by MakeEmailToken.
+func (k *Keyring) ParseEmailToken(tokenString string) (EmailClaims, error) {
+	claims := EmailClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, k.keyFunc, jwt.WithIssuer(string(TokenTypeEmailVerification)))
+	if err != nil {
+		return EmailClaims{}, err
+	}
+	return claims, nil
+}
+
+// ValidateMFAToken validates a token made by MakeMFAToken and returns the
+// ID of its user.
+func (k *Keyring) ValidateMFAToken(tokenString string) (uuid.UUID, error) {
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, k.keyFunc, jwt.WithIssuer(string(TokenTypeMFAChallenge)))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return id, nil
+}
+
+// ParseOAuthJWT validates a token made by MakeOAuthJWT.
+func (k *Keyring) ParseOAuthJWT(tokenString string) (OAuthClaims, error) {
+	claims := OAuthClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, k.keyFunc, jwt.WithIssuer(string(TokenTypeOAuthAccess)))
+	if err != nil {
+		return OAuthClaims{}, err
+	}
+	return claims, nil
+}
+
+// keyFunc picks the key by kid and only accepts the algorithm of that key,
+// so a token can not make us verify with a public key as an HMAC secret.
+func (k *Keyring) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == legacyKeyID {
+		if len(k.hmacSecret) == 0 {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, ErrUnexpectedSigning
+		}
+		return k.hmacSecret, nil
+	}
+
+	key, ok := k.verification[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnexpectedSigning
+	}
+	return key.Public, nil
+}
+
+// JWK is the public part of a key as published in a JWK Set (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys tokens may be verified with. The HS256
+// secret, when in use, is not part of it.
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.verification {
+		jwk := publicJWK(key.Public)
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func publicJWK(key crypto.PublicKey) JWK {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 thumbprint of the required members of
+// j, which encoding/json already writes in lexicographic order.
+func (j JWK) thumbprint() (string, error) {
+	var members any
+	switch j.Kty {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	default:
+		return "", ErrUnsupportedKey
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
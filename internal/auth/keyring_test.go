@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example key and thumbprint from RFC 8037, appendix A.3.
+	jwk := JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	got, err := jwk.thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"
+	if got != want {
+		t.Errorf("thumbprint() = %v, want %v", got, want)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPrivate, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edKey, err := NewKey(edPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := NewKey(rsaPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublic, _ := NewKey(&rsaPrivate.PublicKey)
+
+	userID := uuid.New()
+	oldRing, _ := NewKeyring(rsaKey, nil, "")
+	rotatedRing, _ := NewKeyring(edKey, []Key{rsaPublic}, "")
+	edOnlyRing, _ := NewKeyring(edKey, nil, "")
+	legacyRing, _ := NewKeyring(edKey, nil, "secret")
+
+	oldToken, _ := oldRing.MakeJWT(userID, "user", time.Hour)
+	newToken, _ := rotatedRing.MakeJWT(userID, "user", time.Hour)
+	expiredToken, _ := rotatedRing.MakeJWT(userID, "user", -time.Minute)
+	hmacRing, _ := NewKeyring(Key{}, nil, "secret")
+	legacyToken, _ := hmacRing.MakeJWT(userID, "user", time.Hour)
+
+	// An HS256 token using the published public key as secret and its kid.
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   userID.String(),
+	})
+	confused.Header["kid"] = edKey.ID
+	confusedToken, _ := confused.SignedString([]byte(edKey.Public.(ed25519.PublicKey)))
+
+	tests := []struct {
+		name    string
+		ring    *Keyring
+		token   string
+		wantErr bool
+	}{
+		{name: "Signed with current key", ring: rotatedRing, token: newToken},
+		{name: "Signed with rotated out key", ring: rotatedRing, token: oldToken},
+		{name: "Unknown kid", ring: edOnlyRing, token: oldToken, wantErr: true},
+		{name: "Expired", ring: rotatedRing, token: expiredToken, wantErr: true},
+		{name: "Legacy HS256 with secret", ring: legacyRing, token: legacyToken},
+		{name: "Legacy HS256 without secret", ring: edOnlyRing, token: legacyToken, wantErr: true},
+		{name: "Algorithm confusion", ring: legacyRing, token: confusedToken, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ring.ValidateJWT(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != userID {
+				t.Errorf("ValidateJWT() = %v, want %v", got, userID)
+			}
+		})
+	}
+}
+
+func TestKeyringRoleClaim(t *testing.T) {
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := NewKey(edPrivate)
+	ring, _ := NewKeyring(edKey, nil, "secret")
+
+	token, _ := ring.MakeJWT(uuid.New(), "admin", time.Hour)
+	claims, err := ring.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.Role != "admin" {
+		t.Errorf("ParseJWT() role = %v, want admin", claims.Role)
+	}
+
+	hmacRing, _ := NewKeyring(Key{}, nil, "secret")
+	legacyToken, _ := hmacRing.MakeJWT(uuid.New(), "", time.Hour)
+	claims, err = ring.ParseJWT(legacyToken)
+	if err != nil || claims.Role != "" {
+		t.Errorf("ParseJWT() of token without role = %v, %v, want no role", claims.Role, err)
+	}
+}
+
+func TestKeyringEmailToken(t *testing.T) {
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := NewKey(edPrivate)
+	ring, _ := NewKeyring(edKey, nil, "secret")
+
+	userID, id := uuid.New(), uuid.New()
+	token, err := ring.MakeEmailToken(userID, id, "a@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailToken() error = %v", err)
+	}
+	claims, err := ring.ParseEmailToken(token)
+	if err != nil {
+		t.Fatalf("ParseEmailToken() error = %v", err)
+	}
+	if claims.Subject != userID.String() || claims.ID != id.String() || claims.Email != "a@example.com" {
+		t.Errorf("ParseEmailToken() = %+v, want user %v, id %v, a@example.com", claims, userID, id)
+	}
+
+	if _, err = ring.ValidateJWT(token); err == nil {
+		t.Error("ValidateJWT() accepted an email token")
+	}
+	accessToken, _ := ring.MakeJWT(userID, "user", time.Hour)
+	if _, err = ring.ParseEmailToken(accessToken); err == nil {
+		t.Error("ParseEmailToken() accepted an access token")
+	}
+	expired, _ := ring.MakeEmailToken(userID, id, "a@example.com", -time.Minute)
+	if _, err = ring.ParseEmailToken(expired); err == nil {
+		t.Error("ParseEmailToken() accepted an expired token")
+	}
+}
+
+func TestKeyringMFAToken(t *testing.T) {
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := NewKey(edPrivate)
+	ring, _ := NewKeyring(edKey, nil, "secret")
+
+	userID := uuid.New()
+	token, _ := ring.MakeMFAToken(userID, 5*time.Minute)
+	got, err := ring.ValidateMFAToken(token)
+	if err != nil || got != userID {
+		t.Fatalf("ValidateMFAToken() = %v, %v, want %v", got, err, userID)
+	}
+	if _, err = ring.ValidateJWT(token); err == nil {
+		t.Error("ValidateJWT() accepted an MFA challenge token")
+	}
+	accessToken, _ := ring.MakeJWT(userID, "user", time.Hour)
+	if _, err = ring.ValidateMFAToken(accessToken); err == nil {
+		t.Error("ValidateMFAToken() accepted an access token")
+	}
+}
+
+func TestKeyringOAuthJWT(t *testing.T) {
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := NewKey(edPrivate)
+	ring, _ := NewKeyring(edKey, nil, "secret")
+
+	userID, grantID := uuid.New(), uuid.New()
+	token, _ := ring.MakeOAuthJWT(userID, "client", grantID, []string{"chirps:read", "profile"}, time.Hour)
+	claims, err := ring.ParseOAuthJWT(token)
+	if err != nil {
+		t.Fatalf("ParseOAuthJWT() error = %v", err)
+	}
+	if claims.Subject != userID.String() || claims.ID != grantID.String() || claims.ClientID != "client" {
+		t.Errorf("ParseOAuthJWT() = %+v", claims)
+	}
+	if !claims.HasScope("chirps:read") || !claims.HasScope("profile") || claims.HasScope("chirps:write") {
+		t.Errorf("HasScope() wrong for scope %q", claims.Scope)
+	}
+
+	if _, err = ring.ValidateJWT(token); err == nil {
+		t.Error("ValidateJWT() accepted an OAuth token")
+	}
+	accessToken, _ := ring.MakeJWT(userID, "user", time.Hour)
+	if _, err = ring.ParseOAuthJWT(accessToken); err == nil {
+		t.Error("ParseOAuthJWT() accepted a first party token")
+	}
+}
+
+func TestKeyringJWKS(t *testing.T) {
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := NewKey(edPrivate)
+	ring, _ := NewKeyring(edKey, nil, "secret")
+
+	set := ring.JWKS()
+	if len(set.Keys) != 1 {
+		t.Fatalf("JWKS() has %d keys, want 1", len(set.Keys))
+	}
+	jwk := set.Keys[0]
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+	if jwk.Kid != edKey.ID || jwk.Alg != "EdDSA" || string(x) != string(edPrivate.Public().(ed25519.PublicKey)) {
+		t.Errorf("JWKS() = %+v", jwk)
+	}
+
+	hmacOnly, _ := NewKeyring(Key{}, nil, "secret")
+	if keys := hmacOnly.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS() of HS256 keyring = %+v, want no keys", keys)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edPrivate)
+	privatePath := filepath.Join(dir, "signing.pem")
+	os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	rsaPrivate, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ = x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	publicPath := filepath.Join(dir, "old.pem")
+	os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	ring, err := LoadKeyring(privatePath, []string{publicPath}, "")
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+	if n := len(ring.JWKS().Keys); n != 2 {
+		t.Errorf("JWKS() has %d keys, want 2", n)
+	}
+
+	if _, err = LoadKeyring(publicPath, nil, ""); err == nil {
+		t.Errorf("LoadKeyring() with a public signing key error = nil, want error")
+	}
+	if _, err = LoadKeyring("", nil, ""); err == nil {
+		t.Errorf("LoadKeyring() without keys error = nil, want error")
+	}
+}
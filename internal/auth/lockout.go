@@ -0,0 +1,39 @@
+package auth
+
+import "time"
+
+// LockoutPolicy says how long attempts stay blocked after failed ones.
+// The first FreeAttempts failures cost nothing, each later one doubles the
+// wait starting at BaseDelay, and from LockoutAfter failures on the wait is
+// LockoutDuration. Failures older than Window are forgotten.
+type LockoutPolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// Delay returns the wait after failures consecutive failures.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+	if failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= p.LockoutDuration {
+			return p.LockoutDuration
+		}
+	}
+	return delay
+}
+
+// LockedUntil returns when attempts are allowed again after failures, the
+// last of them at lastFailure.
+func (p LockoutPolicy) LockedUntil(failures int, lastFailure time.Time) time.Time {
+	return lastFailure.Add(p.Delay(failures))
+}
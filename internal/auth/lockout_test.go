@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	p := LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+	}
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{9, 64 * time.Second},
+		{10, 15 * time.Minute},
+		{1000, 15 * time.Minute},
+	}
+	for _, c := range cases {
+		if got := p.Delay(c.failures); got != c.want {
+			t.Errorf("Delay(%d) = %v, want %v", c.failures, got, c.want)
+		}
+	}
+}
+
+func TestLockoutPolicyDelayCapped(t *testing.T) {
+	p := LockoutPolicy{
+		FreeAttempts:    1,
+		BaseDelay:       time.Second,
+		LockoutAfter:    100,
+		LockoutDuration: time.Minute,
+	}
+	if got := p.Delay(50); got != time.Minute {
+		t.Errorf("Delay(50) = %v, want %v", got, time.Minute)
+	}
+}
+
+func TestLockedUntil(t *testing.T) {
+	p := LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Second, LockoutAfter: 5, LockoutDuration: time.Hour}
+	last := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got, want := p.LockedUntil(0, last), last; !got.Equal(want) {
+		t.Errorf("LockedUntil(0) = %v, want %v", got, want)
+	}
+	if got, want := p.LockedUntil(2, last), last.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("LockedUntil(2) = %v, want %v", got, want)
+	}
+}
+
+func TestWastePasswordCheck(t *testing.T) {
+	if err := CheckPasswordHash(dummyPasswordHash, "hunter2"); err == nil {
+		t.Fatal("dummy hash matched a password")
+	}
+}
+
+func TestLockoutPolicyWithoutDelays(t *testing.T) {
+	p := LockoutPolicy{FreeAttempts: 5, LockoutAfter: 5, LockoutDuration: 5 * time.Minute}
+	if got := p.Delay(4); got != 0 {
+		t.Errorf("Delay(4) = %v, want 0", got)
+	}
+	if got := p.Delay(5); got != 5*time.Minute {
+		t.Errorf("Delay(5) = %v, want %v", got, 5*time.Minute)
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// PKCEMethodS256 is the only PKCE method (RFC 7636) accepted. The plain
+// method would let anyone who saw the authorization request redeem the
+// code.
+const PKCEMethodS256 = "S256"
+
+// PKCEChallenge returns the S256 challenge of verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE reports whether verifier is well formed and matches
+// challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		if !isUnreserved(c) {
+			return false
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+func isUnreserved(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Errorf("PKCEChallenge() = %v, want %v", got, challenge)
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{name: "Matching verifier", verifier: verifier, want: true},
+		{name: "Other verifier", verifier: strings.Repeat("a", 43), want: false},
+		{name: "Too short", verifier: verifier[:42], want: false},
+		{name: "Too long", verifier: strings.Repeat("a", 129), want: false},
+		{name: "Invalid character", verifier: verifier[:42] + "+", want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := VerifyPKCE(tc.verifier, challenge); got != tc.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). They are the defaults of authenticator apps,
+// which often ignore any other value in the provisioning URI.
+const (
+	TOTPPeriod = 30
+	TOTPDigits = 6
+	// TOTPSkew is how many periods before and after the current one are
+	// accepted, to tolerate clock drift.
+	TOTPSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random 160 bit secret, base32 encoded as
+// authenticator apps expect it.
+func GenerateTOTPSecret() (string, error) {
+	buff := make([]byte, 20)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buff), nil
+}
+
+// TOTPURI returns the otpauth URI enrolling secret in an authenticator app,
+// usually shown as a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(TOTPDigits))
+	q.Set("period", fmt.Sprint(TOTPPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// TOTPStep returns the time step t falls in.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode returns the code of secret for the given time step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3).
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// ValidateTOTP checks code against the steps around t and returns the step
+// it matched. Callers reject steps not after the last one used, so a code
+// can not be replayed.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	now := TOTPStep(t)
+	for step := now - TOTPSkew; step <= now+TOTPSkew; step++ {
+		want, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n single use codes of 80 random bits,
+// formatted as xxxx-xxxx-xxxx-xxxx. They are stored hashed with
+// HashRecoveryCode.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		buff := make([]byte, 10)
+		if _, err := rand.Read(buff); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(totpEncoding.EncodeToString(buff))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the digest of code, ignoring case, spaces and
+// dashes so codes can be typed back however they were copied.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashRefreshToken(code)
+}
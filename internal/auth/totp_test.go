@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors.
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tc := range tests {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("TOTPCode(%d) = %v, want %v", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+	code, _ := TOTPCode(secret, step)
+	previous, _ := TOTPCode(secret, step-1)
+	stale, _ := TOTPCode(secret, step-2)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current code", code: code, wantStep: step, wantOK: true},
+		{name: "Code with spaces", code: code[:3] + " " + code[3:], wantStep: step, wantOK: true},
+		{name: "Previous code within skew", code: previous, wantStep: step - 1, wantOK: true},
+		{name: "Code outside skew", code: stale, wantOK: false},
+		{name: "Wrong length", code: code[:5], wantOK: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(secret, tc.code, now)
+			if ok != tc.wantOK || (ok && gotStep != tc.wantStep) {
+				t.Errorf("ValidateTOTP() = %v, %v, want %v, %v", gotStep, ok, tc.wantStep, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "a@example.com", "JBSWY3DPEHPK3PXP")
+	for _, want := range []string{"otpauth://totp/Chirpy:a@example.com?", "secret=JBSWY3DPEHPK3PXP", "issuer=Chirpy", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("TOTPURI() = %v, want it to contain %v", uri, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || seen[code] {
+			t.Errorf("GenerateRecoveryCodes() returned %q", code)
+		}
+		seen[code] = true
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))) {
+		t.Error("HashRecoveryCode() depends on case or separators")
+	}
+}
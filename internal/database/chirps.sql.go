@@ -7,29 +7,32 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
 VALUES(
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	ReplyToID uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.ReplyToID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +40,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
 	)
 	return i, err
 }
@@ -60,7 +64,7 @@ func (q *Queries) DeleteChirps(ctx context.Context) error {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -72,12 +76,13 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
 	)
 	return i, err
 }
 
 const getChirpByAuthor = `-- name: GetChirpByAuthor :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
 `
 
 func (q *Queries) GetChirpByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
@@ -95,6 +100,7 @@ func (q *Queries) GetChirpByAuthor(ctx context.Context, userID uuid.UUID) ([]Chi
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
 		); err != nil {
 			return nil, err
 		}
@@ -110,7 +116,7 @@ func (q *Queries) GetChirpByAuthor(ctx context.Context, userID uuid.UUID) ([]Chi
 }
 
 const getChirpByAuthorDesc = `-- name: GetChirpByAuthorDesc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at DESC
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps WHERE user_id = $1 ORDER BY created_at DESC
 `
 
 func (q *Queries) GetChirpByAuthorDesc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
@@ -128,6 +134,7 @@ func (q *Queries) GetChirpByAuthorDesc(ctx context.Context, userID uuid.UUID) ([
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
 		); err != nil {
 			return nil, err
 		}
@@ -143,7 +150,7 @@ func (q *Queries) GetChirpByAuthorDesc(ctx context.Context, userID uuid.UUID) ([
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps ORDER BY created_at ASC
 `
 
 func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
@@ -161,6 +168,48 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsBetween = `-- name: GetChirpsBetween :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps
+WHERE created_at > $1::timestamp AND created_at <= $2::timestamp
+ORDER BY created_at ASC
+`
+
+type GetChirpsBetweenParams struct {
+	After time.Time
+	Until time.Time
+}
+
+func (q *Queries) GetChirpsBetween(ctx context.Context, arg GetChirpsBetweenParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsBetween, arg.After, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
 		); err != nil {
 			return nil, err
 		}
@@ -176,7 +225,7 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsDesc = `-- name: GetChirpsDesc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at DESC
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps ORDER BY created_at DESC
 `
 
 func (q *Queries) GetChirpsDesc(ctx context.Context) ([]Chirp, error) {
@@ -194,6 +243,108 @@ func (q *Queries) GetChirpsDesc(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getListTimeline = `-- name: GetListTimeline :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.reply_to_id FROM chirps
+JOIN list_members ON list_members.user_id = chirps.user_id
+WHERE list_members.list_id = $1
+AND (chirps.created_at < $2 OR (chirps.created_at = $2 AND chirps.id < $3))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type GetListTimelineParams struct {
+	ListID    uuid.UUID
+	CreatedAt time.Time
+	ID        uuid.UUID
+	Limit     int32
+}
+
+func (q *Queries) GetListTimeline(ctx context.Context, arg GetListTimelineParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getListTimeline,
+		arg.ListID,
+		arg.CreatedAt,
+		arg.ID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimeline = `-- name: GetTimeline :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps
+WHERE (user_id = $1 OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1))
+AND (created_at < $2 OR (created_at = $2 AND id < $3))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type GetTimelineParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ID        uuid.UUID
+	Limit     int32
+}
+
+func (q *Queries) GetTimeline(ctx context.Context, arg GetTimelineParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getTimeline,
+		arg.UserID,
+		arg.CreatedAt,
+		arg.ID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
 		); err != nil {
 			return nil, err
 		}
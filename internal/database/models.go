@@ -11,28 +11,273 @@ import (
 	"github.com/google/uuid"
 )
 
+type AggregatorWatermark struct {
+	Name      string
+	Watermark time.Time
+}
+
+type AttemptFailure struct {
+	Kind          string
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	ReplyToID uuid.NullUUID
 }
 
-type RefreshToken struct {
-	Token     string
+type Conversation struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	CreatedBy uuid.UUID
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+	Muted          bool
+}
+
+type EmailVerification struct {
+	ID        uuid.UUID
 	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
 	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type HashtagCount struct {
+	Tag    string
+	Bucket time.Time
+	Count  int32
+}
+
+type List struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	OwnerID   uuid.UUID
+	Name      string
+	IsPrivate bool
+}
+
+type ListMember struct {
+	ListID    uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type Message struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ActorID   uuid.NullUUID
+	Kind      string
+	ChirpID   uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   string
+	RedirectUris []string
+}
+
+type OauthCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthGrant struct {
+	ID        uuid.UUID
+	ClientID  uuid.UUID
+	UserID    uuid.UUID
+	Scopes    []string
+	CreatedAt time.Time
 	RevokedAt sql.NullTime
 }
 
+type OidcState struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   uuid.NullUUID
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type PasswordReset struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Reaction struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	Emoji     string
+	CreatedAt time.Time
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	RotatedAt  sql.NullTime
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+}
+
+type TimelineEntry struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type TrendSuppression struct {
+	Term      string
+	CreatedAt time.Time
+	CreatedBy uuid.NullUUID
+}
+
 type User struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Email             string
+	HashedPassword    string
+	IsChirpyRed       bool
+	DisplayName       string
+	Bio               string
+	AvatarUrl         string
+	Location          string
+	Website           string
+	Username          string
+	UsernameChangedAt sql.NullTime
+	Role              string
+	EmailVerifiedAt   sql.NullTime
+}
+
+type UserHashtag struct {
+	UserID     uuid.UUID
+	Tag        string
+	Count      int32
+	LastUsedAt time.Time
+}
+
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+}
+
+type UserSuggestion struct {
+	UserID         uuid.UUID
+	SuggestedID    uuid.UUID
+	Score          float64
+	MutualCount    int32
+	SharedTagCount int32
+	ComputedAt     time.Time
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    time.Time
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+}
+
+type UsernameHistory struct {
+	Username  string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	EndpointID     uuid.UUID
+	EventType      string
+	Payload        string
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      string
+}
+
+type WebhookEndpoint struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Url        string
+	Secret     string
+	EventTypes []string
+	IsGlobal   bool
 }
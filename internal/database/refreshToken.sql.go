@@ -13,33 +13,53 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at)VALUES(
+INSERT INTO refresh_tokens(token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at)VALUES(
 	$1,
 	NOW(),
 	NOW(),
 	$2,
 	$3,
-	NULL
+	NULL,
+	$4,
+	NULL,
+	$5,
+	$6,
+	NOW()
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
+	TokenHash string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
+	FamilyID  uuid.UUID
+	UserAgent string
+	Ip        string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.Ip,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
@@ -47,52 +67,63 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 const deleteRefreshToken = `-- name: DeleteRefreshToken :one
 UPDATE refresh_tokens 
 SET revoked_at = NOW() 
-WHERE token = $1
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+WHERE token_hash = $1
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at
 `
 
-func (q *Queries) DeleteRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, deleteRefreshToken, token)
+func (q *Queries) DeleteRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, deleteRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token = $1
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at FROM refresh_tokens WHERE token_hash = $1
 `
 
-func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshToken, token)
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
 const getUserWithToken = `-- name: GetUserWithToken :one
-SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red FROM users
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.display_name, users.bio, users.avatar_url, users.location, users.website, users.username, users.username_changed_at, users.role, users.email_verified_at FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
 AND revoked_at IS NULL
+AND rotated_at IS NULL
 AND expires_at > NOW()
 `
 
-func (q *Queries) GetUserWithToken(ctx context.Context, token string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserWithToken, token)
+func (q *Queries) GetUserWithToken(ctx context.Context, tokenHash string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserWithToken, tokenHash)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -101,6 +132,139 @@ func (q *Queries) GetUserWithToken(ctx context.Context, token string) (User, err
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const listUserSessions = `-- name: ListUserSessions :many
+SELECT family_id, user_agent, ip, last_used_at, expires_at,
+	(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::TIMESTAMP AS started_at
+FROM refresh_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND rotated_at IS NULL
+AND expires_at > NOW()
+ORDER BY last_used_at DESC
+`
+
+type ListUserSessionsRow struct {
+	FamilyID   uuid.UUID
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	StartedAt  time.Time
+}
+
+func (q *Queries) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]ListUserSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserSessionsRow
+	for rows.Next() {
+		var i ListUserSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.StartedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
+	return err
+}
+
+const revokeUserRefreshTokenFamily = `-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND family_id = $2
+AND revoked_at IS NULL
+`
+
+type RevokeUserRefreshTokenFamilyParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeUserRefreshTokenFamily(ctx context.Context, arg RevokeUserRefreshTokenFamilyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserRefreshTokenFamily, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET rotated_at = NOW(), updated_at = NOW(), last_used_at = NOW()
+WHERE token_hash = $1
+AND rotated_at IS NULL
+AND revoked_at IS NULL
+AND expires_at > NOW()
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at
+`
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
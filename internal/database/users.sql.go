@@ -7,29 +7,32 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
 VALUES(
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
-	RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+	RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Username       string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Username)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -38,12 +41,30 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const deleteUsernameHistory = `-- name: DeleteUsernameHistory :exec
+DELETE FROM username_history WHERE username = LOWER($1::text)
+`
+
+func (q *Queries) DeleteUsernameHistory(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, deleteUsernameHistory, username)
+	return err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
@@ -56,12 +77,77 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByPreviousUsername = `-- name: GetUserByPreviousUsername :one
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.display_name, users.bio, users.avatar_url, users.location, users.website, users.username, users.username_changed_at, users.role, users.email_verified_at FROM username_history
+JOIN users ON users.id = username_history.user_id
+WHERE username_history.username = LOWER($1::text)
+`
+
+func (q *Queries) GetUserByPreviousUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByPreviousUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at FROM users WHERE LOWER(username) = LOWER($1::text)
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserWithID = `-- name: GetUserWithID :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE id = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserWithID(ctx context.Context, id uuid.UUID) (User, error) {
@@ -74,12 +160,63 @@ func (q *Queries) GetUserWithID(ctx context.Context, id uuid.UUID) (User, error)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const isUsernameReserved = `-- name: IsUsernameReserved :one
+SELECT EXISTS(
+	SELECT 1 FROM username_history
+	WHERE username = LOWER($1::text)
+	AND user_id <> $2
+	AND created_at > $3::timestamp
+)
+`
+
+type IsUsernameReservedParams struct {
+	Username      string
+	UserID        uuid.UUID
+	ReleasedAfter time.Time
+}
+
+func (q *Queries) IsUsernameReserved(ctx context.Context, arg IsUsernameReservedParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUsernameReserved, arg.Username, arg.UserID, arg.ReleasedAfter)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const recordUsernameHistory = `-- name: RecordUsernameHistory :exec
+INSERT INTO username_history (username, user_id, created_at)
+VALUES(
+	LOWER($1::text),
+	$2,
+	NOW()
+)
+ON CONFLICT (username) DO UPDATE SET user_id = EXCLUDED.user_id, created_at = EXCLUDED.created_at
+`
+
+type RecordUsernameHistoryParams struct {
+	Username string
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RecordUsernameHistory(ctx context.Context, arg RecordUsernameHistoryParams) error {
+	_, err := q.db.ExecContext(ctx, recordUsernameHistory, arg.Username, arg.UserID)
+	return err
+}
+
 const setNewEmail = `-- name: SetNewEmail :exec
-UPDATE users SET email = $1 WHERE users.id = $2
+UPDATE users SET email = $1, email_verified_at = NULL WHERE users.id = $2
 `
 
 type SetNewEmailParams struct {
@@ -108,7 +245,7 @@ func (q *Queries) SetNewPassword(ctx context.Context, arg SetNewPasswordParams)
 
 const setRedUser = `-- name: SetRedUser :one
 UPDATE users SET is_chirpy_red = true WHERE users.id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at
 `
 
 func (q *Queries) SetRedUser(ctx context.Context, id uuid.UUID) (User, error) {
@@ -121,6 +258,164 @@ func (q *Queries) SetRedUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const setUsername = `-- name: SetUsername :one
+UPDATE users SET username = $1,
+	username_changed_at = CASE WHEN LOWER(username) = LOWER($1) THEN username_changed_at ELSE NOW() END,
+	updated_at = NOW()
+WHERE users.id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at
+`
+
+type SetUsernameParams struct {
+	Username string
+	ID       uuid.UUID
+}
+
+func (q *Queries) SetUsername(ctx context.Context, arg SetUsernameParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUsername, arg.Username, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users SET display_name = $1, bio = $2, avatar_url = $3, location = $4, website = $5, updated_at = NOW()
+WHERE users.id = $6
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at
+`
+
+type UpdateUserProfileParams struct {
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+	Location    string
+	Website     string
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+		arg.Location,
+		arg.Website,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, avatar_url, location, website, username, username_changed_at, role, email_verified_at
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Location,
+		&i.Website,
+		&i.Username,
+		&i.UsernameChangedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
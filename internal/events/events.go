@@ -0,0 +1,92 @@
+// Package events fans events out to every subscriber of a bus, either
+// inside a single process or across processes through Postgres NOTIFY.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+var ErrClosed = errors.New("event bus closed")
+
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// NewEvent encodes data as the payload of an event of type typ.
+func NewEvent(typ string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: typ, Data: raw}, nil
+}
+
+// Handler receives every event published on a bus, in publishing order.
+// Handlers run on the delivering goroutine and must not block.
+type Handler func(Event)
+
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+	Subscribe(handler Handler)
+	Close() error
+}
+
+// handlers is the subscriber list shared by the Bus implementations.
+type handlers struct {
+	mu     sync.RWMutex
+	list   []Handler
+	closed bool
+}
+
+func (h *handlers) add(handler Handler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.list = append(h.list, handler)
+}
+
+func (h *handlers) dispatch(event Event) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return ErrClosed
+	}
+	for _, handler := range h.list {
+		handler(event)
+	}
+	return nil
+}
+
+func (h *handlers) close() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wasClosed := h.closed
+	h.closed = true
+	return !wasClosed
+}
+
+// Local delivers events to the subscribers of the same process. It suits
+// single node deployments and tests.
+type Local struct {
+	handlers handlers
+}
+
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (b *Local) Publish(ctx context.Context, event Event) error {
+	return b.handlers.dispatch(event)
+}
+
+func (b *Local) Subscribe(handler Handler) {
+	b.handlers.add(handler)
+}
+
+func (b *Local) Close() error {
+	b.handlers.close()
+	return nil
+}
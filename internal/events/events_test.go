@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func TestNewEvent(t *testing.T) {
+	event, err := NewEvent("chirp.created", map[string]string{"body": "hi"})
+	if err != nil {
+		t.Fatalf("NewEvent() error = %v", err)
+	}
+	if event.Type != "chirp.created" || string(event.Data) != `{"body":"hi"}` {
+		t.Errorf("NewEvent() = %v %s", event.Type, event.Data)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	bus := NewLocal()
+
+	var first, second []string
+	bus.Subscribe(func(e Event) { first = append(first, e.Type) })
+	bus.Subscribe(func(e Event) { second = append(second, e.Type) })
+
+	for _, typ := range []string{"a", "b", "c"} {
+		if err := bus.Publish(context.Background(), Event{Type: typ}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if strings.Join(first, "") != "abc" || strings.Join(second, "") != "abc" {
+		t.Errorf("got %v and %v, want both [a b c]", first, second)
+	}
+
+	bus.Close()
+	if err := bus.Publish(context.Background(), Event{Type: "d"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() after Close error = %v, want %v", err, ErrClosed)
+	}
+}
+
+// TestPostgres needs a database, set TEST_DB_URL to run it.
+func TestPostgres(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	channel := "events_test"
+	publisher, err := NewPostgres(db, dbURL, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	subscriber, err := NewPostgres(db, dbURL, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+
+	received := make(chan Event, 1)
+	subscriber.Subscribe(func(e Event) { received <- e })
+
+	event, _ := NewEvent("chirp.created", map[string]string{"body": "hi"})
+	if err = publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got.Type != event.Type || string(got.Data) != string(event.Data) {
+			t.Errorf("received %v %s, want %v %s", got.Type, got.Data, event.Type, event.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not received")
+	}
+
+	big := Event{Type: "big", Data: []byte(`"` + strings.Repeat("a", MaxPayloadSize) + `"`)}
+	if err = publisher.Publish(context.Background(), big); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("Publish() of large event error = %v, want %v", err, ErrPayloadTooLarge)
+	}
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MaxPayloadSize is the largest encoded event Postgres accepts as a NOTIFY
+// payload.
+const MaxPayloadSize = 7999
+
+const listenerPingInterval = 90 * time.Second
+
+var ErrPayloadTooLarge = errors.New("event payload too large")
+
+// Postgres publishes events with NOTIFY on a channel every instance
+// LISTENs to, publishers included, so each event is delivered once per
+// instance. Events sent while an instance is reconnecting are lost to it.
+type Postgres struct {
+	db       *sql.DB
+	listener *pq.Listener
+	channel  string
+	handlers handlers
+	done     chan struct{}
+}
+
+// NewPostgres publishes through db and listens on its own connection to
+// dbURL.
+func NewPostgres(db *sql.DB, dbURL, channel string) (*Postgres, error) {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener: %v", err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	b := &Postgres{
+		db:       db,
+		listener: listener,
+		channel:  channel,
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b, nil
+}
+
+func (b *Postgres) run() {
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case n := <-b.listener.Notify:
+			// A nil notification means the connection was re-established.
+			if n == nil {
+				continue
+			}
+			event := Event{}
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				log.Printf("Failed to decode event: %v", err)
+				continue
+			}
+			if err := b.handlers.dispatch(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			go b.listener.Ping()
+		}
+	}
+}
+
+func (b *Postgres) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxPayloadSize {
+		return ErrPayloadTooLarge
+	}
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+func (b *Postgres) Subscribe(handler Handler) {
+	b.handlers.add(handler)
+}
+
+func (b *Postgres) Close() error {
+	if !b.handlers.close() {
+		return nil
+	}
+	close(b.done)
+	return b.listener.Close()
+}
@@ -0,0 +1,124 @@
+// Package mailer sends transactional emails, over SMTP in production and
+// to a file or log while developing and testing.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidHeader = errors.New("invalid header value")
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Format renders msg as an RFC 5322 message sent by from.
+func Format(from string, msg Message, now time.Time) ([]byte, error) {
+	for _, v := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	b := bytes.Buffer{}
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes(), nil
+}
+
+// SMTP sends mails through an SMTP server, with STARTTLS when the server
+// offers it.
+type SMTP struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTP authenticates with PLAIN when username is not empty.
+func NewSMTP(host, port, username, password, from string) *SMTP {
+	s := &SMTP{
+		Addr: net.JoinHostPort(host, port),
+		From: from,
+	}
+	if username != "" {
+		s.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+// Send uses the address of From, which may carry a display name like
+// "Chirpy <no-reply@chirpy.dev>", as envelope sender.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	data, err := Format(s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, s.Auth, from.Address, []string{msg.To}, data)
+}
+
+// Log writes mails to w instead of sending them.
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLog(w io.Writer, from string) *Log {
+	return &Log{w: w, from: from}
+}
+
+// NewFile appends mails to the file at path.
+func NewFile(path, from string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewLog(f, from), nil
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	data, err := Format(l.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err = l.w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(l.w, "\r\n.\r\n")
+	return err
+}
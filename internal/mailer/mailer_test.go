@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	data, err := Format("Chirpy <no-reply@chirpy.dev>", Message{
+		To:      "a@example.com",
+		Subject: "Verify your email",
+		Body:    "Hi,\nclick the link.",
+	}, now)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+
+	got := string(data)
+	for _, want := range []string{
+		"From: Chirpy <no-reply@chirpy.dev>\r\n",
+		"To: a@example.com\r\n",
+		"Subject: Verify your email\r\n",
+		"Date: Wed, 01 May 2024 12:00:00 +0000\r\n",
+		"\r\n\r\nHi,\r\nclick the link.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Format() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	tests := []Message{
+		{To: "a@example.com\r\nBcc: b@example.com", Subject: "Hi"},
+		{To: "a@example.com", Subject: "Hi\nBcc: b@example.com"},
+	}
+	for _, msg := range tests {
+		if _, err := Format("no-reply@chirpy.dev", msg, time.Now()); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Format(%q) error = %v, want %v", msg, err, ErrInvalidHeader)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	b := bytes.Buffer{}
+	m := NewLog(&b, "no-reply@chirpy.dev")
+
+	err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Hi", Body: "link"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(b.String(), "To: a@example.com\r\n") || !strings.HasSuffix(b.String(), "link\r\n.\r\n") {
+		t.Errorf("Send() wrote %q", b.String())
+	}
+}
+
+// fakeSMTP accepts one mail on a local listener and returns the commands
+// and data it received.
+func fakeSMTP(t *testing.T) (addr string, received <-chan []string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	lines := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tc := textproto.NewConn(conn)
+
+		got := []string{}
+		tc.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				break
+			}
+			got = append(got, line)
+			switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+			case "EHLO":
+				tc.PrintfLine("250 localhost")
+			case "DATA":
+				tc.PrintfLine("354 go ahead")
+				data, err := tc.ReadDotLines()
+				if err != nil {
+					break
+				}
+				got = append(got, data...)
+				tc.PrintfLine("250 queued")
+			case "QUIT":
+				tc.PrintfLine("221 bye")
+				lines <- got
+				return
+			default:
+				tc.PrintfLine("250 ok")
+			}
+		}
+		lines <- got
+	}()
+	return l.Addr().String(), lines
+}
+
+func TestSMTPEnvelopeSender(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	m := NewSMTP(host, port, "", "", "Chirpy <no-reply@chirpy.dev>")
+
+	err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Hi", Body: "link"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := <-received
+	for _, want := range []string{
+		"MAIL FROM:<no-reply@chirpy.dev>",
+		"RCPT TO:<a@example.com>",
+		"From: Chirpy <no-reply@chirpy.dev>",
+	} {
+		if !slices.Contains(got, want) {
+			t.Errorf("server received %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestSMTPRejectsInvalidFrom(t *testing.T) {
+	m := NewSMTP("127.0.0.1", "1", "", "", "Chirpy no-reply")
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Hi"}); err == nil {
+		t.Errorf("Send() error = nil, want error")
+	}
+}
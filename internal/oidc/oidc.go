@@ -0,0 +1,357 @@
+// Package oidc signs users in with an external OpenID Connect provider,
+// using the authorization code flow with PKCE.
+//
+// The provider is configured by its issuer URL alone, its endpoints are
+// read from its discovery document on first use, and ID tokens are
+// verified against the keys it publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey    = errors.New("ID token signed with an unknown key")
+	ErrNonceMismatch = errors.New("ID token nonce mismatch")
+)
+
+// DefaultScopes are asked for when Config.Scopes is empty.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// keysRefreshInterval limits how often an unknown kid triggers a new fetch
+// of the provider keys, so forged tokens can not make us hammer it.
+const keysRefreshInterval = time.Minute
+
+// maxResponseSize bounds the documents read from the provider.
+const maxResponseSize = 1 << 20
+
+// validMethods excludes HMAC, the provider signs with asymmetric keys.
+var validMethods = []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+// Metadata is the part of the discovery document used here.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// StringBool decodes both true and "true", as some providers send
+// email_verified as a string.
+type StringBool bool
+
+func (b *StringBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	case "false", `"false"`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// Claims are the claims of ID tokens.
+type Claims struct {
+	Email         string     `json:"email"`
+	EmailVerified StringBool `json:"email_verified"`
+	Name          string     `json:"name"`
+	Nonce         string     `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func New(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = DefaultScopes
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// Metadata fetches the discovery document once, retrying on later calls
+// if it failed.
+func (p *Provider) Metadata(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	m := Metadata{}
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return Metadata{}, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.cfg.Issuer {
+		return Metadata{}, fmt.Errorf("discovery: issuer %q does not match %q", m.Issuer, p.cfg.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return Metadata{}, errors.New("discovery: missing endpoints")
+	}
+	p.metadata = &m
+	return m, nil
+}
+
+// AuthCodeURL returns the URL sending the user to the provider. state and
+// nonce must be unguessable, and verifier kept secret until Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems code and returns the claims of the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	defer res.Body.Close()
+
+	body := struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}{}
+	if err = json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&body); err != nil {
+		return Claims{}, fmt.Errorf("token response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("token request failed: %s: %s", body.Error, body.Description)
+	}
+	if body.IDToken == "" {
+		return Claims{}, errors.New("token response without id_token")
+	}
+	return p.Verify(ctx, body.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an
+// ID token.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, kid)
+		},
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, err
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, ErrNonceMismatch
+	}
+	if claims.Subject == "" {
+		return Claims{}, errors.New("ID token without subject")
+	}
+	return claims, nil
+}
+
+// key returns the provider key kid. Unknown keys trigger a new fetch of the
+// key set, providers publish new keys before signing with them.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	set := jwks{}
+	p.keysFetchedAt = time.Now()
+	if err = p.getJSON(ctx, m.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("keys: %w", err)
+	}
+	p.keys = map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = key
+		}
+	}
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// lookup accepts tokens without kid when the provider has a single key.
+func (p *Provider) lookup(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(v)
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
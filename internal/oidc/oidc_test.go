@@ -0,0 +1,254 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a minimal OpenID provider issuing ID tokens for a single
+// pending authorization.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu        sync.Mutex
+	key       *rsa.PrivateKey
+	kid       string
+	code      string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	idp := &mockIdP{t: t}
+	idp.rotate()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if id != "client" || secret != "secret" || r.PostForm.Get("code") != idp.code ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "id_token": idp.sign(idp.claims)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) rotate() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.key = key
+	idp.kid = base64.RawURLEncoding.EncodeToString(key.N.Bytes()[:8])
+}
+
+func (idp *mockIdP) sign(claims jwt.MapClaims) string {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	s, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return s
+}
+
+func (idp *mockIdP) idClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            "client",
+		"sub":            "user-1",
+		"email":          "a@example.com",
+		"email_verified": true,
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return New(Config{
+		Issuer:       idp.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+	})
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	verifier := strings.Repeat("v", 43)
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != "client" || q.Get("state") != "state" ||
+		q.Get("nonce") != "nonce" || q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid email profile" {
+		t.Fatalf("AuthCodeURL() = %v", authURL)
+	}
+
+	// The user signs in at the provider, which redirects back with a code.
+	idp.code, idp.challenge, idp.claims = "code", q.Get("code_challenge"), idp.idClaims("nonce")
+
+	claims, err := p.Exchange(ctx, "code", verifier, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "a@example.com" || !bool(claims.EmailVerified) {
+		t.Errorf("Exchange() = %+v", claims)
+	}
+
+	if _, err = p.Exchange(ctx, "code", strings.Repeat("w", 43), "nonce"); err == nil {
+		t.Error("Exchange() accepted a wrong code verifier")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.idClaims("nonce"))
+	forged.Header["kid"] = idp.kid
+	forgedToken, _ := forged.SignedString(other)
+
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.idClaims("nonce")).SignedString([]byte("secret"))
+
+	with := func(name string, value any) string {
+		claims := idp.idClaims("nonce")
+		claims[name] = value
+		return idp.sign(claims)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "Valid token", token: idp.sign(idp.idClaims("nonce"))},
+		{name: "Wrong nonce", token: idp.sign(idp.idClaims("other")), wantErr: true},
+		{name: "Wrong audience", token: with("aud", "someone-else"), wantErr: true},
+		{name: "Wrong issuer", token: with("iss", "https://evil.example.com"), wantErr: true},
+		{name: "Expired", token: with("exp", time.Now().Add(-time.Hour).Unix()), wantErr: true},
+		{name: "No subject", token: with("sub", ""), wantErr: true},
+		{name: "Signed with another key", token: forgedToken, wantErr: true},
+		{name: "Signed with HMAC", token: hmacToken, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tc.token, "nonce")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAfterKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	if _, err := p.Verify(ctx, idp.sign(idp.idClaims("nonce")), "nonce"); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// Keys are refetched at most once per keysRefreshInterval.
+	idp.rotate()
+	token := idp.sign(idp.idClaims("nonce"))
+	if _, err := p.Verify(ctx, token, "nonce"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Verify() right after a fetch error = %v, want %v", err, ErrUnknownKey)
+	}
+	p.keysFetchedAt = time.Now().Add(-keysRefreshInterval)
+	if _, err := p.Verify(ctx, token, "nonce"); err != nil {
+		t.Errorf("Verify() after rotation error = %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                "https://evil.example.com",
+			AuthorizationEndpoint: "https://evil.example.com/authorize",
+			TokenEndpoint:         "https://evil.example.com/token",
+			JWKSURI:               "https://evil.example.com/jwks",
+		})
+	}))
+	defer server.Close()
+
+	p := New(Config{Issuer: server.URL, ClientID: "client"})
+	if _, err := p.Metadata(context.Background()); err == nil {
+		t.Error("Metadata() accepted a discovery document of another issuer")
+	}
+}
+
+func TestStringBool(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    StringBool
+		wantErr bool
+	}{
+		{in: `true`, want: true},
+		{in: `"true"`, want: true},
+		{in: `false`, want: false},
+		{in: `"false"`, want: false},
+		{in: `"yes"`, wantErr: true},
+	}
+	for _, tc := range tests {
+		var got StringBool
+		err := json.Unmarshal([]byte(tc.in), &got)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("Unmarshal(%s) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
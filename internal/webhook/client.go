@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("webhook address not allowed")
+
+// cgnat is the shared address space of RFC 6598, internal to carriers.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// AllowedAddr reports whether webhooks may be sent to addr. Loopback,
+// private, link-local and unspecified addresses reach the network of the
+// server rather than the internet, so they are refused.
+func AllowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!cgnat.Contains(addr)
+}
+
+// NewClient returns the client to send webhooks with. It checks the address
+// it connects to, after DNS resolution, so a hostname can not point it at an
+// internal host, and it does not follow redirects, which could do the same.
+// allowPrivate lifts the address check, for development against localhost.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !AllowedAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,158 @@
+// Package webhook signs and sends outgoing webhook requests.
+//
+// Every request carries a signature header of the form
+//
+//	t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+//
+// keyed with the secret of the endpoint, so receivers can check both who
+// sent the payload and when.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// MaxAttempts is how many times a delivery is tried before it is given up
+// as dead.
+const MaxAttempts = 8
+
+const firstRetryDelay = 30 * time.Second
+const maxRetryDelay = 6 * time.Hour
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook signature too old")
+	ErrUnexpectedStatus = errors.New("unexpected webhook response status")
+)
+
+func NewSecret() (string, error) {
+	buff := make([]byte, 32)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buff), nil
+}
+
+func mac(secret string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "%d.", timestamp)
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Sign returns the signature header value of body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := timestamp.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", t, hex.EncodeToString(mac(secret, t, body)))
+}
+
+// Verify checks header against body and rejects signatures made more than
+// tolerance away from now.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp int64 = -1
+	signatures := [][]byte{}
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidSignature
+		}
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			timestamp = t
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+	if timestamp < 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrExpiredSignature
+	}
+
+	expected := mac(secret, timestamp, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// Backoff returns how long to wait before retrying a delivery that failed
+// attempt times.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := firstRetryDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID string
+	Body       []byte
+}
+
+// Send posts req, signed at the current time, and returns the response
+// status. Responses outside 2xx return ErrUnexpectedStatus.
+func Send(ctx context.Context, client *http.Client, req Request) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "goserver-webhooks")
+	httpReq.Header.Set(EventHeader, req.Event)
+	httpReq.Header.Set(DeliveryHeader, req.DeliveryID)
+	httpReq.Header.Set(SignatureHeader, Sign(req.Secret, time.Now(), req.Body))
+
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("%w: %d", ErrUnexpectedStatus, res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
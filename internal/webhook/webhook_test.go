@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"chirp.created"}`)
+	header := Sign("secret", now, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:   "Valid signature",
+			secret: "secret",
+			header: header,
+			body:   body,
+			now:    now,
+		},
+		{
+			name:   "One of several signatures matches",
+			secret: "secret",
+			header: header + ",v1=00ff",
+			body:   body,
+			now:    now.Add(time.Minute),
+		},
+		{
+			name:    "Wrong secret",
+			secret:  "other",
+			header:  header,
+			body:    body,
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Tampered body",
+			secret:  "secret",
+			header:  header,
+			body:    []byte(`{"type":"user.upgraded"}`),
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Too old",
+			secret:  "secret",
+			header:  header,
+			body:    body,
+			now:     now.Add(10 * time.Minute),
+			wantErr: ErrExpiredSignature,
+		},
+		{
+			name:    "Malformed header",
+			secret:  "secret",
+			header:  "v1=abc",
+			body:    body,
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 30 * time.Second},
+		{attempt: 2, want: time.Minute},
+		{attempt: 5, want: 8 * time.Minute},
+		{attempt: 20, want: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"type":"chirp.created"}`)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		if err := Verify("secret", r.Header.Get(SignatureHeader), got, time.Minute, time.Now()); err != nil {
+			t.Errorf("signature of sent request: %v", err)
+		}
+		if r.Header.Get(EventHeader) != "chirp.created" || r.Header.Get(DeliveryHeader) != "d1" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	req := Request{
+		URL:        server.URL,
+		Secret:     "secret",
+		Event:      "chirp.created",
+		DeliveryID: "d1",
+		Body:       body,
+	}
+
+	got, err := Send(context.Background(), server.Client(), req)
+	if err != nil || got != http.StatusOK {
+		t.Errorf("Send() = %v, %v, want %v", got, err, http.StatusOK)
+	}
+
+	status = http.StatusInternalServerError
+	got, err = Send(context.Background(), server.Client(), req)
+	if !errors.Is(err, ErrUnexpectedStatus) || got != http.StatusInternalServerError {
+		t.Errorf("Send() = %v, %v, want %v with %v", got, err, http.StatusInternalServerError, ErrUnexpectedStatus)
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSecret()
+	if a == b || !strings.HasPrefix(a, "whsec_") {
+		t.Errorf("NewSecret() = %v, %v", a, b)
+	}
+}
+
+func TestAllowedAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := AllowedAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("AllowedAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestNewClientRejectsLoopback(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	req := Request{URL: server.URL, Secret: "secret", Event: "chirp.created", DeliveryID: "1", Body: []byte(`{}`)}
+	_, err := Send(context.Background(), NewClient(time.Second, false), req)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("Send to loopback: got %v, want %v", err, ErrForbiddenAddress)
+	}
+	if called {
+		t.Fatal("server was reached")
+	}
+
+	if _, err = Send(context.Background(), NewClient(time.Second, true), req); err != nil {
+		t.Fatalf("Send with private addresses allowed: %v", err)
+	}
+}
+
+func TestNewClientDoesNotFollowRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect was followed")
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	req := Request{URL: server.URL, Secret: "secret", Event: "chirp.created", DeliveryID: "1", Body: []byte(`{}`)}
+	status, err := Send(context.Background(), NewClient(time.Second, true), req)
+	if !errors.Is(err, ErrUnexpectedStatus) || status != http.StatusTemporaryRedirect {
+		t.Fatalf("Send: got %d, %v", status, err)
+	}
+}
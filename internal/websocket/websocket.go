@@ -0,0 +1,300 @@
+// Package websocket implements the server side of the WebSocket protocol
+// (RFC 6455), enough for JSON messaging: no extensions and no subprotocols.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseTryAgainLater   = 1013
+)
+
+// MaxMessageSize is the largest message, after joining fragments, a Conn
+// accepts from a client.
+const MaxMessageSize = 64 * 1024
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	ErrNotWebSocket    = errors.New("not a websocket handshake")
+	ErrMessageTooBig   = errors.New("message too big")
+	ErrProtocol        = errors.New("websocket protocol error")
+	ErrUnmaskedFrame   = errors.New("client frame is not masked")
+	ErrUnsupportedFlag = errors.New("reserved bits set")
+)
+
+// CloseError is returned by ReadMessage once the peer closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// AcceptKey returns the Sec-WebSocket-Accept value answering key.
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Conn is a server side WebSocket connection. Reads must come from a single
+// goroutine, writes are safe from many.
+type Conn struct {
+	// ReadTimeout, when set, closes connections silent for that long.
+	// Every frame received, pings and pongs included, pushes it back.
+	ReadTimeout time.Duration
+
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// Upgrade completes the handshake of r and takes over its connection.
+// On error a response has already been written to w.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, `{"error":"Not a websocket handshake."}`, http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, `{"error":"Unsupported websocket version."}`, http.StatusUpgradeRequired)
+		return nil, ErrNotWebSocket
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, `{"error":"Not correct websocket key."}`, http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, `{"error":"Websockets not supported."}`, http.StatusInternalServerError)
+		return nil, ErrNotWebSocket
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err = conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return NewConn(conn, rw.Reader), nil
+}
+
+// NewConn wraps an already upgraded connection. br may hold bytes read
+// past the handshake; it is nil when there are none.
+func NewConn(conn net.Conn, br *bufio.Reader) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{conn: conn, br: br}
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and pongs skipped. A close frame is echoed and returned as *CloseError.
+func (c *Conn) ReadMessage() (opcode int, payload []byte, err error) {
+	opcode = -1
+	for {
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err = c.WriteMessage(OpPong, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			closeErr := &CloseError{Code: CloseNormal}
+			if len(data) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(data))
+				closeErr.Reason = string(data[2:])
+			}
+			c.WriteClose(closeErr.Code, "")
+			return 0, nil, closeErr
+		case OpText, OpBinary:
+			if opcode != -1 {
+				return 0, nil, ErrProtocol
+			}
+			opcode = op
+		case OpContinuation:
+			if opcode == -1 {
+				return 0, nil, ErrProtocol
+			}
+		default:
+			return 0, nil, ErrProtocol
+		}
+
+		if len(payload)+len(data) > MaxMessageSize {
+			return 0, nil, ErrMessageTooBig
+		}
+		payload = append(payload, data...)
+		if fin {
+			return opcode, payload, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	if c.ReadTimeout > 0 {
+		if err = c.conn.SetReadDeadline(time.Now().Add(c.ReadTimeout)); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, ErrUnsupportedFlag
+	}
+	opcode = int(header[0] & 0x0F)
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, ErrUnmaskedFrame
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	// Control frames can not be fragmented nor exceed 125 bytes.
+	if opcode >= OpClose && (!fin || length > 125) {
+		return false, 0, nil, ErrProtocol
+	}
+	if length > MaxMessageSize {
+		return false, 0, nil, ErrMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends payload in a single unmasked frame.
+func (c *Conn) WriteMessage(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+	if opcode == OpClose {
+		c.closed = true
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// WriteClose starts the closing handshake with code and reason.
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	return c.WriteMessage(OpClose, append(payload, reason...))
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,242 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// clientFrame builds a masked frame as a client would send it.
+func clientFrame(fin bool, opcode int, payload []byte) []byte {
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame reads one unmasked frame written by the server.
+func readServerFrame(t *testing.T, r *bufio.Reader) (int, []byte) {
+	t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Errorf("reading frame header: %v", err)
+		return -1, nil
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(r, ext)
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Errorf("reading frame payload: %v", err)
+	}
+	return int(header[0] & 0x0F), payload
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example handshake from RFC 6455, section 1.3.
+	got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	want := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if got != want {
+		t.Errorf("AcceptKey() = %v, want %v", got, want)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	big := bytes.Repeat([]byte("a"), 300)
+
+	tests := []struct {
+		name       string
+		frames     [][]byte
+		wantOpcode int
+		wantBody   []byte
+		wantErr    error
+	}{
+		{
+			name:       "Single text frame",
+			frames:     [][]byte{clientFrame(true, OpText, []byte(`{"type":"ping"}`))},
+			wantOpcode: OpText,
+			wantBody:   []byte(`{"type":"ping"}`),
+		},
+		{
+			name:       "Extended length",
+			frames:     [][]byte{clientFrame(true, OpBinary, big)},
+			wantOpcode: OpBinary,
+			wantBody:   big,
+		},
+		{
+			name: "Fragmented message",
+			frames: [][]byte{
+				clientFrame(false, OpText, []byte("hel")),
+				clientFrame(true, OpContinuation, []byte("lo")),
+			},
+			wantOpcode: OpText,
+			wantBody:   []byte("hello"),
+		},
+		{
+			name:    "Continuation without start",
+			frames:  [][]byte{clientFrame(true, OpContinuation, []byte("lo"))},
+			wantErr: ErrProtocol,
+		},
+		{
+			name:    "Unmasked frame",
+			frames:  [][]byte{{0x81, 0x02, 'h', 'i'}},
+			wantErr: ErrUnmaskedFrame,
+		},
+		{
+			name:    "Too big",
+			frames:  [][]byte{clientFrame(true, OpText, bytes.Repeat([]byte("a"), MaxMessageSize+1))},
+			wantErr: ErrMessageTooBig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				for _, frame := range tt.frames {
+					if _, err := client.Write(frame); err != nil {
+						return
+					}
+				}
+			}()
+
+			opcode, body, err := NewConn(server, nil).ReadMessage()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if opcode != tt.wantOpcode || !bytes.Equal(body, tt.wantBody) {
+				t.Errorf("ReadMessage() = %v %q, want %v %q", opcode, body, tt.wantOpcode, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestReadMessageAnswersPing(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		client.Write(clientFrame(true, OpPing, []byte("beat")))
+		opcode, payload := readServerFrame(t, bufio.NewReader(client))
+		if opcode != OpPong || string(payload) != "beat" {
+			t.Errorf("got %v %q, want pong %q", opcode, payload, "beat")
+		}
+		client.Write(clientFrame(true, OpText, []byte("after")))
+	}()
+
+	_, body, err := NewConn(server, nil).ReadMessage()
+	if err != nil || string(body) != "after" {
+		t.Fatalf("ReadMessage() = %q, %v, want %q", body, err, "after")
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		payload := binary.BigEndian.AppendUint16(nil, CloseGoingAway)
+		client.Write(clientFrame(true, OpClose, append(payload, "bye"...)))
+		readServerFrame(t, bufio.NewReader(client))
+	}()
+
+	conn := NewConn(server, nil)
+	_, _, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway || closeErr.Reason != "bye" {
+		t.Fatalf("ReadMessage() error = %v, want close %d", err, CloseGoingAway)
+	}
+	if err = conn.WriteMessage(OpText, []byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("WriteMessage() after close error = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, body, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(OpText, body)
+	}))
+	defer server.Close()
+
+	t.Run("Rejects plain requests", func(t *testing.T) {
+		res, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %v, want %v", res.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Echoes over the upgraded connection", func(t *testing.T) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		key := "dGhlIHNhbXBsZSBub25jZQ=="
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\n" +
+			"Connection: keep-alive, Upgrade\r\nSec-WebSocket-Version: 13\r\n" +
+			"Sec-WebSocket-Key: " + key + "\r\n\r\n"))
+
+		br := bufio.NewReader(conn)
+		res, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("status = %v, want %v", res.StatusCode, http.StatusSwitchingProtocols)
+		}
+		if got := res.Header.Get("Sec-WebSocket-Accept"); got != AcceptKey(key) {
+			t.Errorf("Sec-WebSocket-Accept = %v, want %v", got, AcceptKey(key))
+		}
+
+		conn.Write(clientFrame(true, OpText, []byte("hello")))
+		opcode, payload := readServerFrame(t, br)
+		if opcode != OpText || string(payload) != "hello" {
+			t.Errorf("got %v %q, want text %q", opcode, payload, "hello")
+		}
+	})
+}
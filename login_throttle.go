@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+const (
+	loginFailureAccount = "account"
+	loginFailureIP      = "ip"
+)
+
+// Failures are counted per email so that a locked account looks the same
+// whether it exists or not. Addresses get more room, many users can share
+// one behind a NAT.
+var (
+	accountLockout = auth.LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          24 * time.Hour,
+	}
+	ipLockout = auth.LockoutPolicy{
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		LockoutAfter:    100,
+		LockoutDuration: time.Hour,
+		Window:          24 * time.Hour,
+	}
+)
+
+var errLoginFailed = errors.New("Incorrect email or password.")
+
+// checkLogin returns the user with email if password is theirs. Unknown
+// emails and wrong passwords both give errLoginFailed, after the same bcrypt
+// work, and count as failures of the email and of ip. While either has
+// failed too often it gives *attemptLockedError without checking anything.
+func (cfg *apiConfig) checkLogin(ctx context.Context, email, password, ip string) (database.User, error) {
+	keys := []attemptKey{
+		{kind: loginFailureAccount, key: strings.ToLower(email), policy: accountLockout},
+		{kind: loginFailureIP, key: ip, policy: ipLockout, shared: true},
+	}
+	if err := cfg.beginAttempt(ctx, keys); err != nil {
+		return database.User{}, err
+	}
+
+	user, err := cfg.db.GetUser(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		auth.WastePasswordCheck(password)
+		return database.User{}, errLoginFailed
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	if err = auth.CheckPasswordHash(user.HashedPassword, password); err != nil {
+		return database.User{}, errLoginFailed
+	}
+
+	cfg.succeedAttempt(ctx, keys)
+	return user, nil
+}
+
+// handleUnlockUser lets an admin clear the failed logins and second factor
+// attempts of an account.
+func (cfg *apiConfig) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := stringToUUID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Not correct user id."}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := cfg.db.GetUserWithID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"User not found."}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	err = cfg.db.ClearAttemptFailures(r.Context(), database.ClearAttemptFailuresParams{
+		Kind: loginFailureAccount,
+		Key:  strings.ToLower(user.Email),
+	})
+	if err == nil {
+		err = cfg.db.ClearAttemptFailures(r.Context(), database.ClearAttemptFailuresParams{
+			Kind: mfaAttemptUser,
+			Key:  user.ID.String(),
+		})
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
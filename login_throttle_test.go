@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottled(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int64
+		lastFailureAt time.Time
+		wantCode      int
+		queries       []string
+	}{
+		{"locked out", int64(accountLockout.LockoutAfter), time.Now().UTC(), http.StatusTooManyRequests, []string{"LockAttemptFailure", "LockAttemptFailure"}},
+		{"unknown email counts", 0, time.Now().UTC().Add(-time.Minute), http.StatusUnauthorized, []string{"LockAttemptFailure", "LockAttemptFailure", "RecordAttemptFailure", "RecordAttemptFailure", "GetUser"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := []string{}
+			cfg := newTestConfig(t, func(name string, args []driver.Value) (fakeResult, error) {
+				queries = append(queries, name)
+				switch name {
+				case "LockAttemptFailure":
+					switch {
+					case args[0] == loginFailureAccount && args[1] == "victim@example.com":
+						return attemptFailureResult(args, tt.failures, tt.lastFailureAt), nil
+					case args[0] != loginFailureIP || args[1] != "192.0.2.1":
+						t.Errorf("attempt counted for %v %v", args[0], args[1])
+					}
+					return attemptFailureResult(args, 0, time.Now().UTC().Add(-time.Minute)), nil
+				case "RecordAttemptFailure":
+					return attemptFailureResult(args, tt.failures+1, time.Now().UTC()), nil
+				}
+				return fakeResult{}, nil
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email":"Victim@example.com","password":"guess"}`))
+			w := httptest.NewRecorder()
+			cfg.handlerLogin(w, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if tt.wantCode == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After header")
+			}
+			if strings.Join(queries, ",") != strings.Join(tt.queries, ",") {
+				t.Fatalf("queries = %v, want %v", queries, tt.queries)
+			}
+		})
+	}
+}
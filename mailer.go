@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/MeMetoCoco3/goserver/internal/mailer"
+)
+
+const (
+	mailerLog  = "log"
+	mailerSMTP = "smtp"
+)
+
+const defaultMailFrom = "Chirpy <no-reply@chirpy.local>"
+
+// newMailer returns the mailer selected by MAILER. The default log mailer
+// writes mails to MAIL_LOG_FILE, or to stdout, so verification links can
+// be followed while developing without an SMTP server.
+func newMailer(mode string) (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = defaultMailFrom
+	}
+
+	switch mode {
+	case mailerLog, "":
+		if path := os.Getenv("MAIL_LOG_FILE"); path != "" {
+			return mailer.NewFile(path, from)
+		}
+		return mailer.NewLog(os.Stdout, from), nil
+	case mailerSMTP:
+		host, port := os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT")
+		if host == "" {
+			return nil, errors.New("SMTP_HOST is required by the smtp mailer")
+		}
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTP(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", mode)
+	}
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/google/uuid"
 )
 
 func middlewareLog(next interface{}) http.Handler {
@@ -21,3 +25,25 @@ func middlewareLog(next interface{}) http.Handler {
 		}
 	})
 }
+
+// authenticate returns the ID of the user owning the bearer token of r.
+func (cfg *apiConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	if userID, ok := r.Context().Value(oauthUserKey).(uuid.UUID); ok {
+		return userID, nil
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return cfg.keys.ValidateJWT(token)
+}
+
+// clientIP returns the address r came from. Headers like X-Forwarded-For are
+// ignored, clients can set them to anything.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
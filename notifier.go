@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/events"
+	"github.com/google/uuid"
+)
+
+const notificationQueueSize = 1024
+
+const (
+	notificationMention   = "mention"
+	notificationReply     = "reply"
+	notificationFollow    = "follow"
+	notificationChirpyRed = "chirpy_red"
+	notificationReaction  = "reaction"
+	notificationMessage   = "message"
+)
+
+// notificationJob describes a notification to store for UserID. ActorID is
+// uuid.Nil for notifications raised by the system, like upgrades.
+type notificationJob struct {
+	UserID  uuid.UUID
+	ActorID uuid.UUID
+	Kind    string
+	ChirpID uuid.UUID
+}
+
+// notifier stores notifications in the background so request handlers only
+// pay for a channel send. Stored notifications are published on the event
+// bus for real-time listeners.
+type notifier struct {
+	db    *database.Queries
+	bus   events.Bus
+	queue chan notificationJob
+}
+
+func newNotifier(db *database.Queries, bus events.Bus) *notifier {
+	return &notifier{
+		db:    db,
+		bus:   bus,
+		queue: make(chan notificationJob, notificationQueueSize),
+	}
+}
+
+// Notify queues job without blocking. Jobs are dropped when the queue is full.
+func (n *notifier) Notify(job notificationJob) {
+	if job.UserID == job.ActorID {
+		return
+	}
+	select {
+	case n.queue <- job:
+	default:
+		log.Printf("Notification queue full, dropping %s notification for %s", job.Kind, job.UserID)
+	}
+}
+
+func (n *notifier) run() {
+	for job := range n.queue {
+		if err := n.store(context.Background(), job); err != nil {
+			log.Printf("Failed to store %s notification for %s: %v", job.Kind, job.UserID, err)
+		}
+	}
+}
+
+func (n *notifier) store(ctx context.Context, job notificationJob) error {
+	if job.ActorID != uuid.Nil {
+		blocked, err := n.db.IsBlockedEitherWay(ctx, database.IsBlockedEitherWayParams{
+			UserID:  job.UserID,
+			OtherID: job.ActorID,
+		})
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return nil
+		}
+	}
+
+	notification, err := n.db.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  job.UserID,
+		ActorID: uuid.NullUUID{UUID: job.ActorID, Valid: job.ActorID != uuid.Nil},
+		Kind:    job.Kind,
+		ChirpID: uuid.NullUUID{UUID: job.ChirpID, Valid: job.ChirpID != uuid.Nil},
+	})
+	if err != nil {
+		return err
+	}
+	publishEvent(ctx, n.bus, eventNotificationCreated, notificationEvent{
+		UserID:       job.UserID,
+		Notification: notificationFromDB(notification),
+	})
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	scopeChirpsRead  = "chirps:read"
+	scopeChirpsWrite = "chirps:write"
+	scopeProfile     = "profile"
+)
+
+// oauthScopes lists the scopes clients can ask for, in the order and with
+// the wording of the consent screen.
+var oauthScopes = []struct {
+	Name        string
+	Description string
+}{
+	{scopeChirpsRead, "Read chirps and your timeline"},
+	{scopeChirpsWrite, "Post and delete chirps as you"},
+	{scopeProfile, "Read and update your profile"},
+}
+
+const maxRedirectURIs = 5
+
+type contextKey int
+
+// oauthUserKey holds the user an OAuth access token acts for, once
+// middlewareScope checked the token may reach the route.
+const oauthUserKey contextKey = iota
+
+// parseScopes validates a space separated list of scopes and returns them
+// in canonical order, without duplicates.
+func parseScopes(s string) ([]string, error) {
+	asked := map[string]bool{}
+	for _, scope := range strings.Fields(s) {
+		asked[scope] = true
+	}
+	if len(asked) == 0 {
+		return nil, errors.New("no scope requested")
+	}
+
+	scopes := []string{}
+	for _, scope := range oauthScopes {
+		if asked[scope.Name] {
+			scopes = append(scopes, scope.Name)
+		}
+	}
+	if len(scopes) != len(asked) {
+		return nil, fmt.Errorf("unknown scope in %q", s)
+	}
+	return scopes, nil
+}
+
+// validateRedirectURI only accepts https URIs, or http ones on the loopback
+// interface for native apps and local development (RFC 8252).
+func validateRedirectURI(raw string) error {
+	if len(raw) > maxURLLength {
+		return errors.New("Too long redirect URI")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("Invalid redirect URI %q", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("Redirect URI %q has a fragment", raw)
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	host := u.Hostname()
+	if u.Scheme == "http" && (host == "localhost" || net.ParseIP(host).IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("Redirect URI %q must use https", raw)
+}
+
+// middlewareScope lets access tokens issued to OAuth clients reach next
+// when they were granted scope, and their grant was not revoked. Other
+// requests pass through untouched. Routes not wrapped by it reject OAuth
+// tokens, as auth.Keyring.ValidateJWT does not accept them.
+func (cfg *apiConfig) middlewareScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := cfg.keys.ParseOAuthJWT(token)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !claims.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			http.Error(w, fmt.Sprintf(`{"error":"Token lacks the %s scope."}`, scope), http.StatusForbidden)
+			return
+		}
+		userID, err := uuid.Parse(claims.Subject)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid token."}`, http.StatusUnauthorized)
+			return
+		}
+		grantID, err := uuid.Parse(claims.ID)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid token."}`, http.StatusUnauthorized)
+			return
+		}
+		grant, err := cfg.db.GetActiveOAuthGrant(r.Context(), grantID)
+		if err != nil || grant.UserID != userID {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, `{"error":"Token revoked."}`, http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), oauthUserKey, userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
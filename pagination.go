@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultPageSize = 20
+const maxPageSize = 100
+
+// Page is the envelope of every cursor paginated listing. NextCursor is
+// empty when there are no more items to fetch.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageRequest holds the cursor and limit of a paginated listing. Items are
+// returned newest first, ordered by creation time and then ID, so Before and
+// BeforeID are an exclusive upper bound on both. Items created at the same
+// time are then never skipped across pages.
+type pageRequest struct {
+	Before   time.Time
+	BeforeID uuid.UUID
+	Limit    int32
+}
+
+func parsePage(r *http.Request) (pageRequest, error) {
+	p := pageRequest{
+		Before: time.Now().UTC().Add(time.Hour),
+		Limit:  defaultPageSize,
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		before, beforeID, ok := strings.Cut(cursor, "_")
+		if !ok {
+			return p, fmt.Errorf("Not correct cursor.")
+		}
+		var err error
+		if p.Before, err = time.Parse(time.RFC3339Nano, before); err != nil {
+			return p, fmt.Errorf("Not correct cursor.")
+		}
+		if p.BeforeID, err = uuid.Parse(beforeID); err != nil {
+			return p, fmt.Errorf("Not correct cursor.")
+		}
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("Not correct limit.")
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		p.Limit = int32(n)
+	}
+
+	return p, nil
+}
+
+// nextCursor returns the cursor to fetch the page following one of n items
+// whose last entry, the oldest, was created at last and has ID lastID.
+func (p pageRequest) nextCursor(n int, last time.Time, lastID uuid.UUID) string {
+	if n < int(p.Limit) {
+		return ""
+	}
+	return last.Format(time.RFC3339Nano) + "_" + lastID.String()
+}
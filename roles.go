@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+)
+
+const (
+	roleUser      = "user"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+// roleRanks orders roles, every role holds the permissions of the ones
+// below it.
+var roleRanks = map[string]int{
+	roleUser:      1,
+	roleModerator: 2,
+	roleAdmin:     3,
+}
+
+func hasRole(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// middlewareRequireRole lets through requests whose token carries at least
+// role. The role of the token is checked against the database too, so a
+// demotion takes effect before the tokens issued earlier expire.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			http.Error(w, `{"error":"Not authenticated."}`, http.StatusUnauthorized)
+			return
+		}
+		claims, err := cfg.keys.ParseJWT(token)
+		if err != nil {
+			http.Error(w, `{"error":"Not authenticated."}`, http.StatusUnauthorized)
+			return
+		}
+		if !hasRole(claims.Role, role) {
+			http.Error(w, `{"error":"Not allowed."}`, http.StatusForbidden)
+			return
+		}
+
+		userID, err := stringToUUID(claims.Subject)
+		if err != nil {
+			http.Error(w, `{"error":"Not authenticated."}`, http.StatusUnauthorized)
+			return
+		}
+		user, err := cfg.db.GetUserWithID(r.Context(), userID)
+		if err != nil || !hasRole(user.Role, role) {
+			http.Error(w, `{"error":"Not allowed."}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
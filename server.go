@@ -6,9 +6,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync/atomic"
 
+	"github.com/MeMetoCoco3/goserver/internal/auth"
 	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/events"
+	"github.com/MeMetoCoco3/goserver/internal/mailer"
+	"github.com/MeMetoCoco3/goserver/internal/oidc"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -16,9 +21,21 @@ import (
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	dbConn         *sql.DB
 	who            string
-	jwtSecret      string
+	keys           *auth.Keyring
 	polkaKey       string
+	timeline       timeline
+	notifier       *notifier
+	trends         *trendAggregator
+	suggestions    *suggester
+	chirpStream    *chirpStream
+	gateway        *wsGateway
+	events         events.Bus
+	webhooks       *webhookDispatcher
+	mailer         mailer.Mailer
+	publicURL      string
+	oidc           *oidc.Provider
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -34,6 +51,13 @@ func main() {
 	devEnv := os.Getenv("PLATFORM")
 	jwtS := os.Getenv("JWT_SECRET")
 	polkaAPI := os.Getenv("POLKA_KEY")
+	timelineMode := os.Getenv("TIMELINE_MODE")
+	eventBusMode := os.Getenv("EVENT_BUS")
+	mailerMode := os.Getenv("MAILER")
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		fmt.Println(err)
@@ -42,34 +66,168 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		if err := createAdmin(dbQueries, os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	tl, err := newTimeline(timelineMode, dbQueries)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	keys, err := loadKeyring(os.Getenv("JWT_SIGNING_KEY_FILE"), os.Getenv("JWT_VERIFICATION_KEY_FILES"), jwtS)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	bus, err := newEventBus(eventBusMode, db, dbURL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	mail, err := newMailer(mailerMode)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	cfg := apiConfig{
 		fileserverHits: atomic.Int32{},
 		db:             dbQueries,
+		dbConn:         db,
 		who:            devEnv,
-		jwtSecret:      jwtS,
+		keys:           keys,
 		polkaKey:       polkaAPI,
+		timeline:       tl,
+		notifier:       newNotifier(dbQueries, bus),
+		trends:         newTrendAggregator(dbQueries, db),
+		suggestions:    newSuggester(dbQueries, db),
+		chirpStream:    newChirpStream(),
+		gateway:        newGateway(dbQueries),
+		events:         bus,
+		webhooks:       newWebhookDispatcher(dbQueries, devEnv == "dev"),
+		mailer:         mail,
+		publicURL:      strings.TrimSuffix(publicURL, "/"),
+		oidc:           newOIDCProvider(os.Getenv("OIDC_ISSUER"), os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"), strings.TrimSuffix(publicURL, "/")),
 	}
+	cfg.events.Subscribe(cfg.handleEvent)
+	go cfg.notifier.run()
+	go cfg.trends.run()
+	go cfg.suggestions.run()
+	go cfg.webhooks.run()
+
 	handler := http.NewServeMux()
 
 	fileServer := http.FileServer(http.Dir("."))
 
 	handler.Handle(frontPath, http.StripPrefix(frontPath, middlewareLog(cfg.middlewareMetricsInc(fileServer))))
 
-	handler.Handle(fmt.Sprintf("GET %smetrics", adminPath), middlewareLog(cfg.handleMetrics))
-	handler.Handle(fmt.Sprintf("POST %sreset", adminPath), middlewareLog(cfg.handleReset))
+	// Every admin route needs at least a moderator, routes for admins only
+	// raise the role again.
+	admin := http.NewServeMux()
+	admin.Handle(fmt.Sprintf("GET %smetrics", adminPath), cfg.middlewareRequireRole(roleAdmin, http.HandlerFunc(cfg.handleMetrics)))
+	admin.Handle(fmt.Sprintf("POST %sreset", adminPath), cfg.middlewareRequireRole(roleAdmin, http.HandlerFunc(cfg.handleReset)))
+	admin.HandleFunc(fmt.Sprintf("GET %strends/suppressions", adminPath), cfg.handleGetTrendSuppressions)
+	admin.HandleFunc(fmt.Sprintf("POST %strends/suppressions", adminPath), cfg.handlePostTrendSuppression)
+	admin.HandleFunc(fmt.Sprintf("DELETE %strends/suppressions/{term}", adminPath), cfg.handleDeleteTrendSuppression)
+	admin.Handle(fmt.Sprintf("POST %susers/{id}/unlock", adminPath), cfg.middlewareRequireRole(roleAdmin, http.HandlerFunc(cfg.handleUnlockUser)))
+	admin.Handle(fmt.Sprintf("POST %swebhooks", adminPath), cfg.middlewareRequireRole(roleAdmin, http.HandlerFunc(cfg.handlePostGlobalWebhookEndpoint)))
+	handler.Handle(adminPath, middlewareLog(cfg.middlewareRequireRole(roleModerator, admin)))
+
+	handler.Handle("GET /.well-known/jwks.json", middlewareLog(cfg.handleJWKS))
 	handler.Handle(fmt.Sprintf("GET %shealthz", backPath), middlewareLog(cfg.handleHealthz))
 
 	handler.Handle(fmt.Sprintf("POST %susers", backPath), middlewareLog(cfg.handlePostUser))
-	handler.Handle(fmt.Sprintf("PUT %susers", backPath), middlewareLog(cfg.handlePostUser))
+	handler.Handle(fmt.Sprintf("PUT %susers", backPath), middlewareLog(cfg.handlePutUser))
+	handler.Handle(fmt.Sprintf("GET %susers/verify", backPath), middlewareLog(cfg.handleVerifyEmail))
+	handler.Handle(fmt.Sprintf("POST %susers/me/verification", backPath), middlewareLog(cfg.handleResendVerification))
+	handler.Handle(fmt.Sprintf("POST %susers/me/totp", backPath), middlewareLog(cfg.handleEnrollTOTP))
+	handler.Handle(fmt.Sprintf("POST %susers/me/totp/confirm", backPath), middlewareLog(cfg.handleConfirmTOTP))
+	handler.Handle(fmt.Sprintf("DELETE %susers/me/totp", backPath), middlewareLog(cfg.handleDisableTOTP))
+	handler.Handle(fmt.Sprintf("GET %susers/{id}", backPath), middlewareLog(cfg.handleGetUser))
+	handler.Handle(fmt.Sprintf("GET %susers/me", backPath), middlewareLog(cfg.middlewareScope(scopeProfile, http.HandlerFunc(cfg.handleGetMe))))
+	handler.Handle(fmt.Sprintf("PATCH %susers/me/profile", backPath), middlewareLog(cfg.middlewareScope(scopeProfile, http.HandlerFunc(cfg.handlePatchProfile))))
+	handler.Handle(fmt.Sprintf("GET %susers/me/suggestions", backPath), middlewareLog(cfg.handleGetSuggestions))
+	handler.Handle(fmt.Sprintf("PUT %susers/me/username", backPath), middlewareLog(cfg.handlePutUsername))
+	handler.Handle(fmt.Sprintf("GET %susers/by-handle/{handle}", backPath), middlewareLog(cfg.handleGetUserByHandle))
+
+	handler.Handle(fmt.Sprintf("POST %susers/{id}/follow", backPath), middlewareLog(cfg.handleFollowUser))
+	handler.Handle(fmt.Sprintf("DELETE %susers/{id}/follow", backPath), middlewareLog(cfg.handleUnfollowUser))
+	handler.Handle(fmt.Sprintf("GET %susers/{id}/{relation}", backPath), middlewareLog(cfg.handleGetUserRelation))
+	handler.Handle(fmt.Sprintf("POST %susers/{id}/block", backPath), middlewareLog(cfg.handleBlockUser))
+	handler.Handle(fmt.Sprintf("DELETE %susers/{id}/block", backPath), middlewareLog(cfg.handleUnblockUser))
+	handler.Handle(fmt.Sprintf("POST %susers/{id}/mute", backPath), middlewareLog(cfg.handleMuteUser))
+	handler.Handle(fmt.Sprintf("DELETE %susers/{id}/mute", backPath), middlewareLog(cfg.handleUnmuteUser))
+
+	handler.Handle(fmt.Sprintf("POST %schirps", backPath), middlewareLog(cfg.middlewareScope(scopeChirpsWrite, http.HandlerFunc(cfg.handlePostChirp))))
+	handler.Handle(fmt.Sprintf("GET %schirps", backPath), middlewareLog(cfg.middlewareScope(scopeChirpsRead, http.HandlerFunc(cfg.handleGetChirps))))
+	handler.Handle(fmt.Sprintf("GET %schirps/{id}", backPath), middlewareLog(cfg.middlewareScope(scopeChirpsRead, http.HandlerFunc(cfg.handleGetChirp))))
+	handler.Handle(fmt.Sprintf("GET %schirps/stream", backPath), middlewareLog(cfg.handleChirpStream))
+	handler.Handle(fmt.Sprintf("DELETE %schirps/{id}", backPath), middlewareLog(cfg.middlewareScope(scopeChirpsWrite, http.HandlerFunc(cfg.handleDeleteChirps))))
+	handler.Handle(fmt.Sprintf("GET %schirps/{id}/reactions", backPath), middlewareLog(cfg.handleGetReactions))
+	handler.Handle(fmt.Sprintf("POST %schirps/{id}/reactions", backPath), middlewareLog(cfg.handlePostReaction))
+	handler.Handle(fmt.Sprintf("DELETE %schirps/{id}/reactions/{emoji}", backPath), middlewareLog(cfg.handleDeleteReaction))
+
+	handler.Handle(fmt.Sprintf("GET %stimeline", backPath), middlewareLog(cfg.middlewareScope(scopeChirpsRead, http.HandlerFunc(cfg.handleGetTimeline))))
+	handler.Handle(fmt.Sprintf("GET %strends", backPath), middlewareLog(cfg.handleGetTrends))
+
+	handler.Handle(fmt.Sprintf("GET %snotifications", backPath), middlewareLog(cfg.handleGetNotifications))
+	handler.Handle(fmt.Sprintf("POST %snotifications/read", backPath), middlewareLog(cfg.handleReadNotifications))
+	handler.Handle(fmt.Sprintf("GET %snotifications/unread_count", backPath), middlewareLog(cfg.handleGetUnreadCount))
+
+	handler.Handle(fmt.Sprintf("POST %slists", backPath), middlewareLog(cfg.handlePostList))
+	handler.Handle(fmt.Sprintf("GET %slists/{id}", backPath), middlewareLog(cfg.handleGetList))
+	handler.Handle(fmt.Sprintf("DELETE %slists/{id}", backPath), middlewareLog(cfg.handleDeleteList))
+	handler.Handle(fmt.Sprintf("POST %slists/{id}/members", backPath), middlewareLog(cfg.handleAddListMember))
+	handler.Handle(fmt.Sprintf("DELETE %slists/{id}/members/{user_id}", backPath), middlewareLog(cfg.handleRemoveListMember))
+	handler.Handle(fmt.Sprintf("GET %slists/{id}/timeline", backPath), middlewareLog(cfg.handleGetListTimeline))
+
+	handler.Handle(fmt.Sprintf("POST %sconversations", backPath), middlewareLog(cfg.handlePostConversation))
+	handler.Handle(fmt.Sprintf("GET %sconversations", backPath), middlewareLog(cfg.handleGetConversations))
+	handler.Handle(fmt.Sprintf("GET %sconversations/{id}", backPath), middlewareLog(cfg.handleGetConversation))
+	handler.Handle(fmt.Sprintf("POST %sconversations/{id}/messages", backPath), middlewareLog(cfg.handlePostMessage))
+	handler.Handle(fmt.Sprintf("GET %sconversations/{id}/messages", backPath), middlewareLog(cfg.handleGetMessages))
+	handler.Handle(fmt.Sprintf("POST %sconversations/{id}/read", backPath), middlewareLog(cfg.handleReadConversation))
+	handler.Handle(fmt.Sprintf("POST %sconversations/{id}/mute", backPath), middlewareLog(cfg.handleMuteConversation))
+	handler.Handle(fmt.Sprintf("DELETE %sconversations/{id}/mute", backPath), middlewareLog(cfg.handleUnmuteConversation))
+
+	handler.Handle(fmt.Sprintf("GET %sws", backPath), middlewareLog(cfg.handleWebSocket))
+
+	handler.Handle(fmt.Sprintf("POST %swebhooks", backPath), middlewareLog(cfg.handlePostWebhookEndpoint))
+	handler.Handle(fmt.Sprintf("GET %swebhooks", backPath), middlewareLog(cfg.handleGetWebhookEndpoints))
+	handler.Handle(fmt.Sprintf("DELETE %swebhooks/{id}", backPath), middlewareLog(cfg.handleDeleteWebhookEndpoint))
+	handler.Handle(fmt.Sprintf("GET %swebhooks/{id}/deliveries", backPath), middlewareLog(cfg.handleGetWebhookDeliveries))
+	handler.Handle(fmt.Sprintf("POST %swebhooks/{id}/deliveries/{delivery_id}/redeliver", backPath), middlewareLog(cfg.handleRedeliverWebhook))
 
-	handler.Handle(fmt.Sprintf("POST %schirps", backPath), middlewareLog(cfg.handlePostChirp))
-	handler.Handle(fmt.Sprintf("GET %schirps", backPath), middlewareLog(cfg.handleGetChirps))
-	handler.Handle(fmt.Sprintf("GET %schirps/{id}", backPath), middlewareLog(cfg.handleGetChirp))
-	handler.Handle(fmt.Sprintf("DELETE %schirps/{id}", backPath), middlewareLog(cfg.handleDeleteChirps))
+	handler.Handle(fmt.Sprintf("POST %soauth/clients", backPath), middlewareLog(cfg.handlePostOAuthClient))
+	handler.Handle(fmt.Sprintf("GET %soauth/clients", backPath), middlewareLog(cfg.handleGetOAuthClients))
+	handler.Handle(fmt.Sprintf("DELETE %soauth/clients/{id}", backPath), middlewareLog(cfg.handleDeleteOAuthClient))
+	handler.Handle(fmt.Sprintf("GET %soauth/grants", backPath), middlewareLog(cfg.handleGetOAuthGrants))
+	handler.Handle(fmt.Sprintf("DELETE %soauth/grants/{id}", backPath), middlewareLog(cfg.handleDeleteOAuthGrant))
+	handler.Handle(fmt.Sprintf("GET %sauthorize", oauthPath), middlewareLog(cfg.handleGetAuthorize))
+	handler.Handle(fmt.Sprintf("POST %sauthorize", oauthPath), middlewareLog(cfg.handlePostAuthorize))
+	handler.Handle(fmt.Sprintf("POST %stoken", oauthPath), middlewareLog(cfg.handleOAuthToken))
+	handler.Handle(fmt.Sprintf("POST %srevoke", oauthPath), middlewareLog(cfg.handleOAuthRevoke))
 
 	handler.Handle(fmt.Sprintf("POST %srevoke", backPath), middlewareLog(cfg.handleRevoke))
 	handler.Handle(fmt.Sprintf("POST %srefresh", backPath), middlewareLog(cfg.handlerRefresh))
+	handler.Handle(fmt.Sprintf("GET %ssessions", backPath), middlewareLog(cfg.handleGetSessions))
+	handler.Handle(fmt.Sprintf("DELETE %ssessions/{id}", backPath), middlewareLog(cfg.handleDeleteSession))
+	handler.Handle(fmt.Sprintf("POST %ssessions/revoke-all", backPath), middlewareLog(cfg.handleRevokeAllSessions))
 	handler.Handle(fmt.Sprintf("POST %slogin", backPath), middlewareLog(cfg.handlerLogin))
+	handler.Handle(fmt.Sprintf("POST %slogin/mfa", backPath), middlewareLog(cfg.handleLoginMFA))
+	handler.Handle(fmt.Sprintf("GET %sauth/oidc/login", backPath), middlewareLog(cfg.handleOIDCLogin))
+	handler.Handle(fmt.Sprintf("POST %sauth/oidc/link", backPath), middlewareLog(cfg.handleOIDCLink))
+	handler.Handle(fmt.Sprintf("GET %sauth/oidc/callback", backPath), middlewareLog(cfg.handleOIDCCallback))
+	handler.Handle(fmt.Sprintf("POST %spassword/forgot", backPath), middlewareLog(cfg.handleForgotPassword))
+	handler.Handle(fmt.Sprintf("POST %spassword/reset", backPath), middlewareLog(cfg.handleResetPassword))
 	handler.Handle(fmt.Sprintf("POST %spolka/webhooks", backPath), middlewareLog(cfg.handlerWebhook))
 	server := http.Server{
 		Handler: handler,
@@ -0,0 +1,21 @@
+-- name: LockAttemptFailure :one
+INSERT INTO attempt_failures(kind, key, failures, last_failure_at)
+VALUES($1, $2, 0, $3)
+ON CONFLICT (kind, key) DO UPDATE SET kind = EXCLUDED.kind
+RETURNING *;
+
+-- name: RecordAttemptFailure :one
+INSERT INTO attempt_failures(kind, key, failures, last_failure_at)
+VALUES(sqlc.arg(kind), sqlc.arg(key), 1, sqlc.arg(last_failure_at))
+ON CONFLICT (kind, key) DO UPDATE SET
+	failures = CASE WHEN attempt_failures.last_failure_at < sqlc.arg(window_start)::TIMESTAMP THEN 1 ELSE attempt_failures.failures + 1 END,
+	last_failure_at = EXCLUDED.last_failure_at
+RETURNING *;
+
+-- name: UndoAttemptFailure :exec
+UPDATE attempt_failures
+SET failures = GREATEST(failures - 1, 0)
+WHERE kind = $1 AND key = $2;
+
+-- name: ClearAttemptFailures :exec
+DELETE FROM attempt_failures WHERE kind = $1 AND key = $2;
@@ -1,11 +1,12 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
 VALUES(
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
 RETURNING *;
 
@@ -29,3 +30,23 @@ DELETE FROM chirps WHERE id = $1;
 
 -- name: DeleteChirps :exec
 TRUNCATE TABLE chirps CASCADE;
+
+-- name: GetTimeline :many
+SELECT * FROM chirps
+WHERE (user_id = $1 OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1))
+AND (created_at < $2 OR (created_at = $2 AND id < $3))
+ORDER BY created_at DESC, id DESC
+LIMIT $4;
+
+-- name: GetListTimeline :many
+SELECT chirps.* FROM chirps
+JOIN list_members ON list_members.user_id = chirps.user_id
+WHERE list_members.list_id = $1
+AND (chirps.created_at < $2 OR (chirps.created_at = $2 AND chirps.id < $3))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4;
+
+-- name: GetChirpsBetween :many
+SELECT * FROM chirps
+WHERE created_at > sqlc.arg(after)::timestamp AND created_at <= sqlc.arg(until)::timestamp
+ORDER BY created_at ASC;
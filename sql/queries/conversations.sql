@@ -0,0 +1,62 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at, created_by)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1
+)
+RETURNING *;
+
+-- name: GetConversation :one
+SELECT * FROM conversations WHERE id = $1;
+
+-- name: GetUserConversations :many
+SELECT conversations.* FROM conversations
+JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversation_members.user_id = $1
+AND (conversations.updated_at < $2 OR (conversations.updated_at = $2 AND conversations.id < $3))
+ORDER BY conversations.updated_at DESC, conversations.id DESC
+LIMIT $4;
+
+-- name: TouchConversation :exec
+UPDATE conversations SET updated_at = NOW() WHERE id = $1;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at, last_read_at, muted)
+VALUES(
+	$1,
+	$2,
+	NOW(),
+	NULL,
+	false
+);
+
+-- name: GetConversationMember :one
+SELECT * FROM conversation_members WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: GetConversationMembers :many
+SELECT * FROM conversation_members WHERE conversation_id = $1 ORDER BY joined_at ASC;
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_members SET last_read_at = NOW() WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: SetConversationMuted :exec
+UPDATE conversation_members SET muted = $1 WHERE conversation_id = $2 AND user_id = $3;
+
+-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, conversation_id, sender_id, body)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3
+)
+RETURNING *;
+
+-- name: GetMessages :many
+SELECT * FROM messages
+WHERE conversation_id = $1 AND (created_at < $2 OR (created_at = $2 AND id < $3))
+ORDER BY created_at DESC, id DESC
+LIMIT $4;
@@ -0,0 +1,14 @@
+-- name: CreateEmailVerification :exec
+INSERT INTO email_verifications (id, user_id, email, created_at, expires_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	NOW(),
+	$4
+);
+
+-- name: UseEmailVerification :one
+UPDATE email_verifications SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
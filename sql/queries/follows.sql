@@ -0,0 +1,39 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES(
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: IsFollowing :one
+SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2);
+
+-- name: GetFollowersAmong :many
+SELECT follower_id FROM follows
+WHERE followee_id = sqlc.arg(user_id) AND follower_id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: GetFollowers :many
+SELECT f.follower_id AS user_id, f.created_at,
+	EXISTS(SELECT 1 FROM follows m WHERE m.follower_id = f.followee_id AND m.followee_id = f.follower_id) AS is_mutual
+FROM follows f
+WHERE f.followee_id = $1 AND (f.created_at < $2 OR (f.created_at = $2 AND f.follower_id < $3))
+ORDER BY f.created_at DESC, f.follower_id DESC
+LIMIT $4;
+
+-- name: GetFollowing :many
+SELECT f.followee_id AS user_id, f.created_at,
+	EXISTS(SELECT 1 FROM follows m WHERE m.follower_id = f.followee_id AND m.followee_id = f.follower_id) AS is_mutual
+FROM follows f
+WHERE f.follower_id = $1 AND (f.created_at < $2 OR (f.created_at = $2 AND f.followee_id < $3))
+ORDER BY f.created_at DESC, f.followee_id DESC
+LIMIT $4;
+
+-- name: GetFollowCounts :one
+SELECT
+	(SELECT COUNT(*) FROM follows WHERE followee_id = sqlc.arg(user_id)) AS followers,
+	(SELECT COUNT(*) FROM follows WHERE follower_id = sqlc.arg(user_id)) AS following;
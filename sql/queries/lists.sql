@@ -0,0 +1,35 @@
+-- name: CreateList :one
+INSERT INTO lists (id, created_at, updated_at, owner_id, name, is_private)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3
+)
+RETURNING *;
+
+-- name: GetList :one
+SELECT * FROM lists WHERE id = $1;
+
+-- name: GetUserLists :many
+SELECT * FROM lists WHERE owner_id = $1 ORDER BY created_at ASC;
+
+-- name: DeleteList :exec
+DELETE FROM lists WHERE id = $1 AND owner_id = $2;
+
+-- name: AddListMember :exec
+INSERT INTO list_members (list_id, user_id, created_at)
+VALUES(
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveListMember :exec
+DELETE FROM list_members WHERE list_id = $1 AND user_id = $2;
+
+-- name: GetListMemberIDs :many
+SELECT user_id FROM list_members WHERE list_id = $1 ORDER BY created_at ASC;
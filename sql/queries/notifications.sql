@@ -0,0 +1,38 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, created_at, user_id, actor_id, kind, chirp_id, read_at)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	NULL
+)
+RETURNING *;
+
+-- name: GetNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id)
+AND (created_at < sqlc.arg(before) OR (created_at = sqlc.arg(before) AND id < sqlc.arg(before_id)::uuid))
+AND (NOT sqlc.arg(unread_only)::bool OR read_at IS NULL)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size)::int;
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL
+AND (actor_id IS NULL OR actor_id NOT IN (
+	SELECT blocked_id FROM blocks WHERE blocker_id = $1
+	UNION
+	SELECT blocker_id FROM blocks WHERE blocked_id = $1
+	UNION
+	SELECT muted_id FROM mutes WHERE muter_id = $1
+));
+
+-- name: MarkNotificationsRead :exec
+UPDATE notifications SET read_at = NOW()
+WHERE user_id = sqlc.arg(user_id) AND id = ANY(sqlc.arg(ids)::uuid[]) AND read_at IS NULL;
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL;
@@ -0,0 +1,66 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, owner_id, name, secret_hash, redirect_uris)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: GetOAuthClientsByOwner :many
+SELECT * FROM oauth_clients WHERE owner_id = $1 ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :exec
+DELETE FROM oauth_clients WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	NOW(),
+	$7
+);
+
+-- name: UseOAuthCode :one
+UPDATE oauth_codes SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreateOAuthGrant :one
+INSERT INTO oauth_grants (id, client_id, user_id, scopes, created_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	NOW()
+)
+RETURNING *;
+
+-- name: GetActiveOAuthGrant :one
+SELECT * FROM oauth_grants WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: GetUserOAuthGrants :many
+SELECT oauth_grants.*, oauth_clients.name AS client_name FROM oauth_grants
+JOIN oauth_clients ON oauth_clients.id = oauth_grants.client_id
+WHERE oauth_grants.user_id = $1 AND oauth_grants.revoked_at IS NULL
+ORDER BY oauth_grants.created_at DESC;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_grants SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeClientOAuthGrant :exec
+UPDATE oauth_grants SET revoked_at = NOW()
+WHERE id = $1 AND client_id = $2 AND revoked_at IS NULL;
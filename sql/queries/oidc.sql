@@ -0,0 +1,31 @@
+-- name: CreateOIDCState :exec
+INSERT INTO oidc_states (state_hash, nonce, code_verifier, link_user_id, created_at, expires_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	$4,
+	NOW(),
+	$5
+);
+
+-- name: UseOIDCState :one
+DELETE FROM oidc_states WHERE state_hash = $1 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCStates :exec
+DELETE FROM oidc_states WHERE expires_at <= NOW();
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities WHERE issuer = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (issuer, subject, user_id, email, created_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	$4,
+	NOW()
+)
+RETURNING *;
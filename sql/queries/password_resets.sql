@@ -0,0 +1,22 @@
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+VALUES(
+	$1,
+	$2,
+	NOW(),
+	$3
+);
+
+-- name: UsePasswordReset :one
+UPDATE password_resets SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeletePasswordResets :exec
+DELETE FROM password_resets WHERE user_id = $1;
+
+-- name: HasRecentPasswordReset :one
+SELECT EXISTS(
+	SELECT 1 FROM password_resets
+	WHERE user_id = $1 AND used_at IS NULL AND expires_at > NOW() AND created_at > $2
+);
@@ -0,0 +1,18 @@
+-- name: AddReaction :execrows
+INSERT INTO reactions (chirp_id, user_id, emoji, created_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveReaction :exec
+DELETE FROM reactions WHERE chirp_id = $1 AND user_id = $2 AND emoji = $3;
+
+-- name: GetReactionCounts :many
+SELECT emoji, COUNT(*) AS count FROM reactions
+WHERE chirp_id = $1
+GROUP BY emoji
+ORDER BY count DESC, emoji ASC;
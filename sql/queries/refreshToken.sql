@@ -1,28 +1,70 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at)VALUES(
+INSERT INTO refresh_tokens(token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at)VALUES(
 	$1,
 	NOW(),
 	NOW(),
 	$2,
 	$3,
-	NULL
+	NULL,
+	$4,
+	NULL,
+	$5,
+	$6,
+	NOW()
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one 
-SELECT * FROM refresh_tokens WHERE token = $1;
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
 
 -- name: GetUserWithToken :one
 SELECT users.* FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
 AND revoked_at IS NULL
+AND rotated_at IS NULL
 AND expires_at > NOW();
 
 -- name: DeleteRefreshToken :one
 UPDATE refresh_tokens 
 SET revoked_at = NOW() 
-WHERE token = $1
+WHERE token_hash = $1
 RETURNING *;
 
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET rotated_at = NOW(), updated_at = NOW(), last_used_at = NOW()
+WHERE token_hash = $1
+AND rotated_at IS NULL
+AND revoked_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: ListUserSessions :many
+SELECT family_id, user_agent, ip, last_used_at, expires_at,
+	(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::TIMESTAMP AS started_at
+FROM refresh_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND rotated_at IS NULL
+AND expires_at > NOW()
+ORDER BY last_used_at DESC;
 
+-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND family_id = $2
+AND revoked_at IS NULL;
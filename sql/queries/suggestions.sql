@@ -0,0 +1,98 @@
+-- name: IncrementUserHashtag :exec
+INSERT INTO user_hashtags (user_id, tag, count, last_used_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	$4
+)
+ON CONFLICT (user_id, tag) DO UPDATE SET
+	count = user_hashtags.count + EXCLUDED.count,
+	last_used_at = GREATEST(user_hashtags.last_used_at, EXCLUDED.last_used_at);
+
+-- name: DeleteUserHashtagsBefore :exec
+DELETE FROM user_hashtags WHERE last_used_at < $1;
+
+-- name: GetUserIDsAfter :many
+SELECT id FROM users
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: GetSuggestionCandidates :many
+WITH fof AS (
+	SELECT f2.followee_id AS candidate_id, COUNT(*) AS mutual_count
+	FROM follows f1
+	JOIN follows f2 ON f2.follower_id = f1.followee_id
+	WHERE f1.follower_id = sqlc.arg(user_id)
+	GROUP BY f2.followee_id
+), shared AS (
+	SELECT other.user_id AS candidate_id, COUNT(*) AS shared_tag_count
+	FROM user_hashtags mine
+	JOIN user_hashtags other ON other.tag = mine.tag AND other.user_id <> mine.user_id
+	WHERE mine.user_id = sqlc.arg(user_id)
+	GROUP BY other.user_id
+), candidates AS (
+	SELECT candidate_id FROM fof
+	UNION
+	SELECT candidate_id FROM shared
+)
+SELECT c.candidate_id,
+	COALESCE(fof.mutual_count, 0)::bigint AS mutual_count,
+	COALESCE(shared.shared_tag_count, 0)::bigint AS shared_tag_count,
+	(SELECT COUNT(*) FROM chirps WHERE chirps.user_id = c.candidate_id AND chirps.created_at >= sqlc.arg(active_since)::timestamp) AS recent_chirps
+FROM candidates c
+LEFT JOIN fof ON fof.candidate_id = c.candidate_id
+LEFT JOIN shared ON shared.candidate_id = c.candidate_id
+WHERE c.candidate_id <> sqlc.arg(user_id)
+AND NOT EXISTS (SELECT 1 FROM follows WHERE follower_id = sqlc.arg(user_id) AND followee_id = c.candidate_id)
+AND NOT EXISTS (
+	SELECT 1 FROM blocks
+	WHERE (blocker_id = sqlc.arg(user_id) AND blocked_id = c.candidate_id)
+	OR (blocker_id = c.candidate_id AND blocked_id = sqlc.arg(user_id))
+)
+AND NOT EXISTS (SELECT 1 FROM mutes WHERE muter_id = sqlc.arg(user_id) AND muted_id = c.candidate_id);
+
+-- name: DeleteUserSuggestions :exec
+DELETE FROM user_suggestions WHERE user_id = $1;
+
+-- name: CreateUserSuggestion :exec
+INSERT INTO user_suggestions (user_id, suggested_id, score, mutual_count, shared_tag_count, computed_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	NOW()
+);
+
+-- name: GetUserSuggestions :many
+SELECT s.suggested_id, s.score, s.mutual_count, s.shared_tag_count
+FROM user_suggestions s
+WHERE s.user_id = sqlc.arg(user_id)
+AND NOT EXISTS (SELECT 1 FROM follows WHERE follower_id = sqlc.arg(user_id) AND followee_id = s.suggested_id)
+AND NOT EXISTS (
+	SELECT 1 FROM blocks
+	WHERE (blocker_id = sqlc.arg(user_id) AND blocked_id = s.suggested_id)
+	OR (blocker_id = s.suggested_id AND blocked_id = sqlc.arg(user_id))
+)
+AND NOT EXISTS (SELECT 1 FROM mutes WHERE muter_id = sqlc.arg(user_id) AND muted_id = s.suggested_id)
+ORDER BY s.score DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: GetPopularUsers :many
+SELECT u.id,
+	(SELECT COUNT(*) FROM follows WHERE followee_id = u.id) AS follower_count,
+	(SELECT COUNT(*) FROM chirps WHERE chirps.user_id = u.id AND chirps.created_at >= sqlc.arg(active_since)::timestamp) AS recent_chirps
+FROM users u
+WHERE u.id <> sqlc.arg(user_id)
+AND NOT EXISTS (SELECT 1 FROM follows WHERE follower_id = sqlc.arg(user_id) AND followee_id = u.id)
+AND NOT EXISTS (
+	SELECT 1 FROM blocks
+	WHERE (blocker_id = sqlc.arg(user_id) AND blocked_id = u.id)
+	OR (blocker_id = u.id AND blocked_id = sqlc.arg(user_id))
+)
+AND NOT EXISTS (SELECT 1 FROM mutes WHERE muter_id = sqlc.arg(user_id) AND muted_id = u.id)
+ORDER BY follower_count DESC, recent_chirps DESC
+LIMIT sqlc.arg(max_results);
@@ -0,0 +1,28 @@
+-- name: FanOutChirp :exec
+INSERT INTO timeline_entries (user_id, chirp_id, created_at)
+SELECT follower_id, sqlc.arg(chirp_id)::uuid, sqlc.arg(created_at)::timestamp
+FROM follows WHERE followee_id = sqlc.arg(user_id)::uuid
+UNION ALL
+SELECT sqlc.arg(user_id)::uuid, sqlc.arg(chirp_id)::uuid, sqlc.arg(created_at)::timestamp
+ON CONFLICT DO NOTHING;
+
+-- name: BackfillTimeline :exec
+INSERT INTO timeline_entries (user_id, chirp_id, created_at)
+SELECT sqlc.arg(user_id)::uuid, id, created_at FROM chirps
+WHERE chirps.user_id = sqlc.arg(author_id)::uuid
+ORDER BY created_at DESC
+LIMIT 100
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveTimelineAuthor :exec
+DELETE FROM timeline_entries
+WHERE timeline_entries.user_id = sqlc.arg(user_id)::uuid
+AND chirp_id IN (SELECT id FROM chirps WHERE chirps.user_id = sqlc.arg(author_id)::uuid);
+
+-- name: GetTimelineEntries :many
+SELECT chirps.* FROM timeline_entries
+JOIN chirps ON chirps.id = timeline_entries.chirp_id
+WHERE timeline_entries.user_id = $1
+AND (timeline_entries.created_at < $2 OR (timeline_entries.created_at = $2 AND timeline_entries.chirp_id < $3))
+ORDER BY timeline_entries.created_at DESC, timeline_entries.chirp_id DESC
+LIMIT $4;
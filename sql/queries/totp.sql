@@ -0,0 +1,42 @@
+-- name: EnrollUserTOTP :one
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES(
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_used_step = 0
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp WHERE user_id = $1;
+
+-- name: ConfirmUserTOTP :one
+UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL
+RETURNING *;
+
+-- name: UseTOTPStep :one
+UPDATE user_totp SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2
+RETURNING *;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, user_id, created_at)
+VALUES(
+	$1,
+	$2,
+	NOW()
+);
+
+-- name: UseRecoveryCode :one
+UPDATE recovery_codes SET used_at = NOW()
+WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL
+RETURNING *;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
@@ -0,0 +1,50 @@
+-- name: IncrementHashtagCount :exec
+INSERT INTO hashtag_counts (tag, bucket, count)
+VALUES(
+	$1,
+	$2,
+	$3
+)
+ON CONFLICT (tag, bucket) DO UPDATE SET count = hashtag_counts.count + EXCLUDED.count;
+
+-- name: GetHashtagWindowCounts :many
+SELECT tag,
+	COALESCE(SUM(count) FILTER (WHERE bucket >= sqlc.arg(window_start)::timestamp), 0)::bigint AS window_count,
+	COALESCE(SUM(count) FILTER (WHERE bucket < sqlc.arg(window_start)::timestamp), 0)::bigint AS baseline_count
+FROM hashtag_counts
+WHERE bucket >= sqlc.arg(baseline_start)::timestamp
+AND tag NOT IN (SELECT term FROM trend_suppressions)
+GROUP BY tag
+HAVING SUM(count) FILTER (WHERE bucket >= sqlc.arg(window_start)::timestamp) > 0;
+
+-- name: DeleteHashtagCountsBefore :exec
+DELETE FROM hashtag_counts WHERE bucket < $1;
+
+-- name: GetWatermark :one
+SELECT watermark FROM aggregator_watermarks WHERE name = $1;
+
+-- name: SetWatermark :exec
+INSERT INTO aggregator_watermarks (name, watermark)
+VALUES(
+	$1,
+	$2
+)
+ON CONFLICT (name) DO UPDATE SET watermark = EXCLUDED.watermark;
+
+-- name: CreateTrendSuppression :exec
+INSERT INTO trend_suppressions (term, created_at, created_by)
+VALUES(
+	$1,
+	NOW(),
+	$2
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteTrendSuppression :exec
+DELETE FROM trend_suppressions WHERE term = $1;
+
+-- name: GetTrendSuppressions :many
+SELECT * FROM trend_suppressions ORDER BY term ASC;
+
+-- name: TryAdvisoryXactLock :one
+SELECT pg_try_advisory_xact_lock(sqlc.arg(key)::bigint);
@@ -1,11 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
 VALUES(
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
 	RETURNING *;
 
@@ -20,8 +21,58 @@ SELECT * FROM users WHERE id = $1;
 UPDATE users SET hashed_password = $1 WHERE users.id = $2;
 
 -- name: SetNewEmail :exec
-UPDATE users SET email = $1 WHERE users.id = $2;
+UPDATE users SET email = $1, email_verified_at = NULL WHERE users.id = $2;
 
 -- name: SetRedUser :one
 UPDATE users SET is_chirpy_red = true WHERE users.id = $1
 RETURNING *;
+
+-- name: UpdateUserProfile :one
+UPDATE users SET display_name = $1, bio = $2, avatar_url = $3, location = $4, website = $5, updated_at = NOW()
+WHERE users.id = $6
+RETURNING *;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users WHERE LOWER(username) = LOWER(sqlc.arg(username)::text);
+
+-- name: SetUsername :one
+UPDATE users SET username = $1,
+	username_changed_at = CASE WHEN LOWER(username) = LOWER($1) THEN username_changed_at ELSE NOW() END,
+	updated_at = NOW()
+WHERE users.id = $2
+RETURNING *;
+
+-- name: RecordUsernameHistory :exec
+INSERT INTO username_history (username, user_id, created_at)
+VALUES(
+	LOWER(sqlc.arg(username)::text),
+	sqlc.arg(user_id),
+	NOW()
+)
+ON CONFLICT (username) DO UPDATE SET user_id = EXCLUDED.user_id, created_at = EXCLUDED.created_at;
+
+-- name: GetUserByPreviousUsername :one
+SELECT users.* FROM username_history
+JOIN users ON users.id = username_history.user_id
+WHERE username_history.username = LOWER(sqlc.arg(username)::text);
+
+-- name: IsUsernameReserved :one
+SELECT EXISTS(
+	SELECT 1 FROM username_history
+	WHERE username = LOWER(sqlc.arg(username)::text)
+	AND user_id <> sqlc.arg(user_id)
+	AND created_at > sqlc.arg(released_after)::timestamp
+);
+
+-- name: DeleteUsernameHistory :exec
+DELETE FROM username_history WHERE username = LOWER(sqlc.arg(username)::text);
+
+-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
@@ -0,0 +1,61 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, event_types, is_global)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints WHERE id = $1;
+
+-- name: GetWebhookEndpointsByUser :many
+SELECT * FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: CountWebhookEndpointsByUser :one
+SELECT COUNT(*) FROM webhook_endpoints WHERE user_id = $1;
+
+-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebhookDeliveries :exec
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error)
+SELECT gen_random_uuid(), NOW(), NOW(), id, sqlc.arg(event_type)::text, sqlc.arg(payload)::text, 'pending', 0, NOW(), NULL, NULL, ''
+FROM webhook_endpoints
+WHERE sqlc.arg(event_type)::text = ANY(event_types)
+AND (is_global OR user_id = sqlc.arg(user_id)::uuid);
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries SET next_attempt_at = NOW() + INTERVAL '2 minutes', updated_at = NOW()
+WHERE id IN (
+	SELECT id FROM webhook_deliveries
+	WHERE status = 'pending' AND next_attempt_at <= NOW()
+	ORDER BY next_attempt_at ASC
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries
+SET status = $2, attempts = attempts + 1, next_attempt_at = $3, last_attempt_at = NOW(), response_status = $4, last_error = $5, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+AND (created_at < $2 OR (created_at = $2 AND id < $3))
+ORDER BY created_at DESC, id DESC
+LIMIT $4;
+
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND endpoint_id = $2
+RETURNING *;
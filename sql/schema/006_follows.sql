@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE follows(
+	follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (follower_id, followee_id),
+	CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows(followee_id, created_at, follower_id);
+
+-- +goose Down
+DROP TABLE follows;
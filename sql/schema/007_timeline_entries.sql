@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE timeline_entries(
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX timeline_entries_user_id_created_at_idx ON timeline_entries(user_id, created_at DESC, chirp_id DESC);
+
+-- +goose Down
+DROP TABLE timeline_entries;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE chirps ADD reply_to_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN reply_to_id;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users ADD display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD location TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD website TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN website;
+ALTER TABLE users DROP COLUMN location;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN display_name;
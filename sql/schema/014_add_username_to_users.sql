@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE users ADD username TEXT;
+UPDATE users SET username = 'user_' || substr(replace(id::text, '-', ''), 1, 10);
+ALTER TABLE users ALTER COLUMN username SET NOT NULL;
+ALTER TABLE users ADD username_changed_at TIMESTAMP;
+
+CREATE UNIQUE INDEX users_username_lower_idx ON users(LOWER(username));
+
+CREATE TABLE username_history(
+	username TEXT PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE username_history;
+DROP INDEX users_username_lower_idx;
+ALTER TABLE users DROP COLUMN username_changed_at;
+ALTER TABLE users DROP COLUMN username;
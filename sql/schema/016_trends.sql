@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE hashtag_counts(
+	tag TEXT NOT NULL,
+	bucket TIMESTAMP NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (tag, bucket)
+);
+
+CREATE INDEX hashtag_counts_bucket_idx ON hashtag_counts(bucket);
+
+CREATE TABLE trend_suppressions(
+	term TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	created_by UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE aggregator_watermarks(
+	name TEXT PRIMARY KEY,
+	watermark TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE aggregator_watermarks;
+DROP TABLE trend_suppressions;
+DROP TABLE hashtag_counts;
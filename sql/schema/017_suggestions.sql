@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE user_hashtags(
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	tag TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	last_used_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, tag)
+);
+
+CREATE INDEX user_hashtags_tag_idx ON user_hashtags(tag);
+
+CREATE TABLE user_suggestions(
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	suggested_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	score DOUBLE PRECISION NOT NULL,
+	mutual_count INTEGER NOT NULL,
+	shared_tag_count INTEGER NOT NULL,
+	computed_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, suggested_id)
+);
+
+CREATE INDEX chirps_user_id_created_at_idx ON chirps(user_id, created_at);
+
+-- +goose Down
+DROP INDEX chirps_user_id_created_at_idx;
+DROP TABLE user_suggestions;
+DROP TABLE user_hashtags;
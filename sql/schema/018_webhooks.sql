@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE webhook_endpoints(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	event_types TEXT[] NOT NULL,
+	is_global BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX webhook_endpoints_user_id_idx ON webhook_endpoints(user_id);
+
+CREATE TABLE webhook_deliveries(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	endpoint_id UUID NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_attempt_at TIMESTAMP,
+	response_status INTEGER,
+	last_error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX webhook_deliveries_endpoint_id_idx ON webhook_deliveries(endpoint_id, created_at DESC, id DESC);
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
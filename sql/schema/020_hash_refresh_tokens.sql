@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- Digests can not be turned back into tokens, so every session ends.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Attempts that may be abused, like password reset requests, are counted
+-- per kind and key, for example per submitted email.
+CREATE TABLE attempt_failures(
+	kind TEXT NOT NULL,
+	key TEXT NOT NULL,
+	failures INTEGER NOT NULL,
+	last_failure_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (kind, key)
+);
+
+-- +goose Down
+DROP TABLE attempt_failures;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE user_totp(
+	user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	confirmed_at TIMESTAMP,
+	last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes(
+	code_hash TEXT PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes(user_id);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
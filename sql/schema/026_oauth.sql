@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	secret_hash TEXT NOT NULL,
+	redirect_uris TEXT[] NOT NULL
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients(owner_id);
+
+CREATE TABLE oauth_codes(
+	code_hash TEXT PRIMARY KEY,
+	client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scopes TEXT[] NOT NULL,
+	code_challenge TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+
+CREATE TABLE oauth_grants(
+	id UUID PRIMARY KEY,
+	client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX oauth_grants_user_id_idx ON oauth_grants(user_id);
+
+-- +goose Down
+DROP TABLE oauth_grants;
+DROP TABLE oauth_codes;
+DROP TABLE oauth_clients;
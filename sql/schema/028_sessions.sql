@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN last_used_at TIMESTAMP;
+UPDATE refresh_tokens SET last_used_at = updated_at;
+ALTER TABLE refresh_tokens ALTER COLUMN last_used_at SET NOT NULL;
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens(user_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN last_used_at;
+ALTER TABLE refresh_tokens DROP COLUMN ip;
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
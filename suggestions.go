@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const suggestionsInterval = time.Hour
+const suggestionsWatermark = "suggestions"
+const suggestionsBatchSize = 100
+const maxStoredSuggestions = 50
+
+// suggestionsLockID is the advisory lock held while collecting interests, so
+// only one instance adds a given run of chirps to them.
+const suggestionsLockID = 0x73756767657374
+
+// Hashtags used within suggestionInterestWindow count as interests of a
+// user, chirps within suggestionActivityWindow count as recent activity.
+const suggestionInterestWindow = 30 * 24 * time.Hour
+const suggestionActivityWindow = 7 * 24 * time.Hour
+
+// suggestionScore ranks a candidate. Accounts followed by people the user
+// follows weigh most, then shared hashtags, then how active the account is.
+func suggestionScore(mutualCount, sharedTagCount, recentChirps int64) float64 {
+	return 3*float64(mutualCount) + 2*float64(sharedTagCount) + math.Log1p(float64(recentChirps))
+}
+
+// suggester precomputes who-to-follow suggestions of every user in the
+// background, so reads are a single indexed lookup.
+type suggester struct {
+	db     *database.Queries
+	dbConn *sql.DB
+}
+
+func newSuggester(db *database.Queries, dbConn *sql.DB) *suggester {
+	return &suggester{
+		db:     db,
+		dbConn: dbConn,
+	}
+}
+
+func (s *suggester) run() {
+	s.tick()
+	ticker := time.NewTicker(suggestionsInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.tick()
+	}
+}
+
+func (s *suggester) tick() {
+	ctx := context.Background()
+	if err := s.collectInterests(ctx); err != nil {
+		log.Printf("Failed to collect interests: %v", err)
+	}
+	s.computeAll(ctx)
+}
+
+// collectInterests adds the hashtags of the chirps created since the last run
+// to the interests of their authors, and forgets those not used within
+// suggestionInterestWindow. The first run reads back the whole window. It
+// skips the run while another instance holds suggestionsLockID.
+func (s *suggester) collectInterests(ctx context.Context) error {
+	now := time.Now().UTC()
+	until := now.Add(-trendIngestLag)
+
+	tx, err := s.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	locked, err := qtx.TryAdvisoryXactLock(ctx, suggestionsLockID)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+
+	after, err := qtx.GetWatermark(ctx, suggestionsWatermark)
+	if errors.Is(err, sql.ErrNoRows) {
+		after = now.Add(-suggestionInterestWindow)
+	} else if err != nil {
+		return err
+	}
+	if !until.After(after) {
+		return nil
+	}
+
+	chirps, err := qtx.GetChirpsBetween(ctx, database.GetChirpsBetweenParams{
+		After: after,
+		Until: until,
+	})
+	if err != nil {
+		return err
+	}
+
+	type userTagKey struct {
+		userID uuid.UUID
+		tag    string
+	}
+	userTags := map[userTagKey]database.IncrementUserHashtagParams{}
+	for _, chirp := range chirps {
+		for _, tag := range extractHashtags(chirp.Body) {
+			key := userTagKey{userID: chirp.UserID, tag: tag}
+			userTag := userTags[key]
+			userTag.UserID = chirp.UserID
+			userTag.Tag = tag
+			userTag.Count++
+			if chirp.CreatedAt.After(userTag.LastUsedAt) {
+				userTag.LastUsedAt = chirp.CreatedAt
+			}
+			userTags[key] = userTag
+		}
+	}
+
+	for _, userTag := range userTags {
+		if err = qtx.IncrementUserHashtag(ctx, userTag); err != nil {
+			return err
+		}
+	}
+	err = qtx.SetWatermark(ctx, database.SetWatermarkParams{
+		Name:      suggestionsWatermark,
+		Watermark: until,
+	})
+	if err != nil {
+		return err
+	}
+	if err = qtx.DeleteUserHashtagsBefore(ctx, now.Add(-suggestionInterestWindow)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *suggester) computeAll(ctx context.Context) {
+	after := uuid.Nil
+	for {
+		ids, err := s.db.GetUserIDsAfter(ctx, database.GetUserIDsAfterParams{
+			ID:    after,
+			Limit: suggestionsBatchSize,
+		})
+		if err != nil {
+			log.Printf("Failed to list users for suggestions: %v", err)
+			return
+		}
+		for _, id := range ids {
+			if err = s.compute(ctx, id); err != nil {
+				log.Printf("Failed to compute suggestions of %s: %v", id, err)
+			}
+		}
+		if len(ids) < suggestionsBatchSize {
+			return
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// compute replaces the stored suggestions of userID.
+func (s *suggester) compute(ctx context.Context, userID uuid.UUID) error {
+	candidates, err := s.db.GetSuggestionCandidates(ctx, database.GetSuggestionCandidatesParams{
+		UserID:      userID,
+		ActiveSince: time.Now().UTC().Add(-suggestionActivityWindow),
+	})
+	if err != nil {
+		return err
+	}
+
+	suggestions := make([]database.CreateUserSuggestionParams, 0, len(candidates))
+	for _, c := range candidates {
+		suggestions = append(suggestions, database.CreateUserSuggestionParams{
+			UserID:         userID,
+			SuggestedID:    c.CandidateID,
+			Score:          suggestionScore(c.MutualCount, c.SharedTagCount, c.RecentChirps),
+			MutualCount:    int32(c.MutualCount),
+			SharedTagCount: int32(c.SharedTagCount),
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	if len(suggestions) > maxStoredSuggestions {
+		suggestions = suggestions[:maxStoredSuggestions]
+	}
+
+	tx, err := s.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	if err = qtx.DeleteUserSuggestions(ctx, userID); err != nil {
+		return err
+	}
+	for _, suggestion := range suggestions {
+		if err = qtx.CreateUserSuggestion(ctx, suggestion); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/auth"
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+// An attemptKey is something attempts are counted for, like the email a
+// password reset is asked for.
+type attemptKey struct {
+	kind   string
+	key    string
+	policy auth.LockoutPolicy
+	// shared keys, like addresses, are used by many users. A success only
+	// gives back its own attempt instead of clearing their failures.
+	shared bool
+}
+
+type attemptLockedError struct {
+	kind  string
+	until time.Time
+}
+
+func (e *attemptLockedError) Error() string {
+	return "Too many attempts, try again later."
+}
+
+// retryAfter returns the Retry-After header value for e.
+func (e *attemptLockedError) retryAfter() string {
+	return strconv.Itoa(int(math.Ceil(time.Until(e.until).Seconds())))
+}
+
+// beginAttempt counts an attempt as failed for every key before it is made,
+// so concurrent attempts can not all get past the lockout: the rows of the
+// keys stay locked from the check until the attempt is counted. It gives
+// *attemptLockedError, counting nothing, while a key is locked out. Attempts
+// that succeed are taken back with succeedAttempt.
+func (cfg *apiConfig) beginAttempt(ctx context.Context, keys []attemptKey) error {
+	now := time.Now().UTC()
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	var locked *attemptLockedError
+	for _, k := range keys {
+		failure, err := qtx.LockAttemptFailure(ctx, database.LockAttemptFailureParams{
+			Kind:          k.kind,
+			Key:           k.key,
+			LastFailureAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		if failure.LastFailureAt.Before(now.Add(-k.policy.Window)) {
+			continue
+		}
+		until := k.policy.LockedUntil(int(failure.Failures), failure.LastFailureAt)
+		if !until.After(now) {
+			continue
+		}
+		if locked == nil {
+			locked = &attemptLockedError{kind: k.kind, until: until}
+		} else if until.After(locked.until) {
+			locked.until = until
+		}
+	}
+	if locked != nil {
+		return locked
+	}
+
+	for _, k := range keys {
+		_, err = qtx.RecordAttemptFailure(ctx, database.RecordAttemptFailureParams{
+			Kind:          k.kind,
+			Key:           k.key,
+			LastFailureAt: now,
+			WindowStart:   now.Add(-k.policy.Window),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// succeedAttempt takes back an attempt begun by beginAttempt.
+func (cfg *apiConfig) succeedAttempt(ctx context.Context, keys []attemptKey) {
+	for _, k := range keys {
+		var err error
+		if k.shared {
+			err = cfg.db.UndoAttemptFailure(ctx, database.UndoAttemptFailureParams{Kind: k.kind, Key: k.key})
+		} else {
+			err = cfg.db.ClearAttemptFailures(ctx, database.ClearAttemptFailuresParams{Kind: k.kind, Key: k.key})
+		}
+		if err != nil {
+			log.Printf("Failed to clear attempt failures: %v", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const timelineModeRead = "read"
+const timelineModeWrite = "write"
+
+// timeline builds the home timeline of a user: their own chirps plus the
+// chirps of everyone they follow.
+type timeline interface {
+	Read(ctx context.Context, userID uuid.UUID, p pageRequest) ([]database.Chirp, error)
+	AddChirp(ctx context.Context, chirp database.Chirp) error
+	Follow(ctx context.Context, followerID, followeeID uuid.UUID) error
+	Unfollow(ctx context.Context, followerID, followeeID uuid.UUID) error
+}
+
+func newTimeline(mode string, db *database.Queries) (timeline, error) {
+	switch mode {
+	case timelineModeRead, "":
+		return &readTimeline{db: db}, nil
+	case timelineModeWrite:
+		return &writeTimeline{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown timeline mode %q", mode)
+	}
+}
+
+// readTimeline joins chirps and follows every time a timeline is read.
+type readTimeline struct {
+	db *database.Queries
+}
+
+func (t *readTimeline) Read(ctx context.Context, userID uuid.UUID, p pageRequest) ([]database.Chirp, error) {
+	return t.db.GetTimeline(ctx, database.GetTimelineParams{
+		UserID:    userID,
+		CreatedAt: p.Before,
+		ID:        p.BeforeID,
+		Limit:     p.Limit,
+	})
+}
+
+func (t *readTimeline) AddChirp(ctx context.Context, chirp database.Chirp) error {
+	return nil
+}
+
+func (t *readTimeline) Follow(ctx context.Context, followerID, followeeID uuid.UUID) error {
+	return nil
+}
+
+func (t *readTimeline) Unfollow(ctx context.Context, followerID, followeeID uuid.UUID) error {
+	return nil
+}
+
+// writeTimeline materializes timelines in timeline_entries, copying every
+// new chirp to the author and all of their followers.
+type writeTimeline struct {
+	db *database.Queries
+}
+
+func (t *writeTimeline) Read(ctx context.Context, userID uuid.UUID, p pageRequest) ([]database.Chirp, error) {
+	return t.db.GetTimelineEntries(ctx, database.GetTimelineEntriesParams{
+		UserID:    userID,
+		CreatedAt: p.Before,
+		ChirpID:   p.BeforeID,
+		Limit:     p.Limit,
+	})
+}
+
+func (t *writeTimeline) AddChirp(ctx context.Context, chirp database.Chirp) error {
+	return t.db.FanOutChirp(ctx, database.FanOutChirpParams{
+		ChirpID:   chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UserID:    chirp.UserID,
+	})
+}
+
+func (t *writeTimeline) Follow(ctx context.Context, followerID, followeeID uuid.UUID) error {
+	return t.db.BackfillTimeline(ctx, database.BackfillTimelineParams{
+		UserID:   followerID,
+		AuthorID: followeeID,
+	})
+}
+
+func (t *writeTimeline) Unfollow(ctx context.Context, followerID, followeeID uuid.UUID) error {
+	return t.db.RemoveTimelineAuthor(ctx, database.RemoveTimelineAuthorParams{
+		UserID:   followerID,
+		AuthorID: followeeID,
+	})
+}
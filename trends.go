@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+)
+
+const trendsInterval = time.Minute
+const trendsWatermark = "trends"
+
+// trendsLockID is the advisory lock held while aggregating, so only one
+// instance adds a given run of chirps to the shared counts.
+const trendsLockID = 0x7472656e6473
+
+// Hashtags are counted in buckets of trendBucketSize. Counts older than the
+// baseline of the largest window are deleted.
+const trendBucketSize = 5 * time.Minute
+const trendBaseline = 7 * 24 * time.Hour
+const trendMinCount = 3
+const maxTrends = 10
+
+// Chirps younger than trendIngestLag are left for the next run, so rows
+// from transactions still in flight are not skipped by the watermark.
+const trendIngestLag = 5 * time.Second
+
+var trendWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// extractHashtags returns the distinct hashtags of body, lower cased and
+// without the leading #.
+func extractHashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]struct{}{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// trendScore measures how far count, seen over window, is above what the
+// baseline rate of the tag predicts for a window of that length.
+func trendScore(count, baselineCount int64, window time.Duration) float64 {
+	expected := float64(baselineCount) * float64(window) / float64(trendBaseline)
+	return (float64(count) - expected) / math.Sqrt(expected+1)
+}
+
+// trendAggregator counts hashtags of new chirps in the background and keeps
+// the current trends of every window in memory, so reads never scan chirps.
+type trendAggregator struct {
+	db     *database.Queries
+	dbConn *sql.DB
+
+	mu     sync.RWMutex
+	trends map[string]Trends
+}
+
+func newTrendAggregator(db *database.Queries, dbConn *sql.DB) *trendAggregator {
+	return &trendAggregator{
+		db:     db,
+		dbConn: dbConn,
+		trends: map[string]Trends{},
+	}
+}
+
+func (a *trendAggregator) run() {
+	a.tick()
+	ticker := time.NewTicker(trendsInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.tick()
+	}
+}
+
+func (a *trendAggregator) tick() {
+	ctx := context.Background()
+	if err := a.aggregate(ctx); err != nil {
+		log.Printf("Failed to aggregate hashtags: %v", err)
+	}
+	if err := a.refresh(ctx); err != nil {
+		log.Printf("Failed to refresh trends: %v", err)
+	}
+}
+
+// aggregate adds the hashtags of the chirps created since the last run to
+// their buckets. It skips the run while another instance holds trendsLockID.
+func (a *trendAggregator) aggregate(ctx context.Context) error {
+	now := time.Now().UTC()
+	until := now.Add(-trendIngestLag)
+
+	tx, err := a.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := a.db.WithTx(tx)
+
+	locked, err := qtx.TryAdvisoryXactLock(ctx, trendsLockID)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+
+	after, err := qtx.GetWatermark(ctx, trendsWatermark)
+	if errors.Is(err, sql.ErrNoRows) {
+		after = now.Add(-trendBaseline)
+	} else if err != nil {
+		return err
+	}
+	if !until.After(after) {
+		return nil
+	}
+
+	chirps, err := qtx.GetChirpsBetween(ctx, database.GetChirpsBetweenParams{
+		After: after,
+		Until: until,
+	})
+	if err != nil {
+		return err
+	}
+
+	type bucketKey struct {
+		tag    string
+		bucket time.Time
+	}
+	counts := map[bucketKey]int32{}
+	for _, chirp := range chirps {
+		bucket := chirp.CreatedAt.Truncate(trendBucketSize)
+		for _, tag := range extractHashtags(chirp.Body) {
+			counts[bucketKey{tag: tag, bucket: bucket}]++
+		}
+	}
+
+	for key, count := range counts {
+		err = qtx.IncrementHashtagCount(ctx, database.IncrementHashtagCountParams{
+			Tag:    key.tag,
+			Bucket: key.bucket,
+			Count:  count,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = qtx.SetWatermark(ctx, database.SetWatermarkParams{
+		Name:      trendsWatermark,
+		Watermark: until,
+	})
+	if err != nil {
+		return err
+	}
+	if err = qtx.DeleteHashtagCountsBefore(ctx, now.Add(-trendBaseline-24*time.Hour)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// refresh recomputes the trends of every window from the stored buckets.
+func (a *trendAggregator) refresh(ctx context.Context) error {
+	now := time.Now().UTC()
+	trends := map[string]Trends{}
+
+	for name, window := range trendWindows {
+		windowStart := now.Add(-window)
+		rows, err := a.db.GetHashtagWindowCounts(ctx, database.GetHashtagWindowCountsParams{
+			WindowStart:   windowStart,
+			BaselineStart: windowStart.Add(-trendBaseline),
+		})
+		if err != nil {
+			return err
+		}
+
+		items := []Trend{}
+		for _, row := range rows {
+			if row.WindowCount < trendMinCount {
+				continue
+			}
+			score := trendScore(row.WindowCount, row.BaselineCount, window)
+			if score <= 0 {
+				continue
+			}
+			items = append(items, Trend{
+				Tag:   row.Tag,
+				Count: row.WindowCount,
+				Score: score,
+			})
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Score > items[j].Score
+		})
+		if len(items) > maxTrends {
+			items = items[:maxTrends]
+		}
+
+		trends[name] = Trends{
+			Window:     name,
+			ComputedAt: now,
+			Trends:     items,
+		}
+	}
+
+	a.mu.Lock()
+	a.trends = trends
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *trendAggregator) Trends(window string) (Trends, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	t, ok := a.trends[window]
+	return t, ok
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"github.com/google/uuid"
 	"time"
 )
@@ -8,35 +9,198 @@ import (
 const frontPath = "/app/"
 const backPath = "/api/"
 const adminPath = "/admin/"
+const oauthPath = "/oauth/"
 const defaultExpSeconds = 3600
+const refreshTokenDuration = 60 * 24 * time.Hour
+const emailVerificationDuration = 24 * time.Hour
+const passwordResetDuration = time.Hour
+const passwordResetCooldown = time.Minute
+const mfaChallengeDuration = 5 * time.Minute
+const recoveryCodeCount = 10
+const oauthCodeDuration = time.Minute
+const oauthAccessTokenDuration = time.Hour
+const oidcStateDuration = 10 * time.Minute
+const maxUserAgentLength = 512
 const ASC = "ASC"
 const DESC = "DESC"
 
 type User struct {
-	ID               uuid.UUID   `json:"id"`
-	CreatedAt        time.Time   `json:"created_at"`
-	UpdatedAt        time.Time   `json:"updated_at"`
-	Email            string      `json:"email"`
-	HashedPassword   string      `json:"password"`
-	ExpiresInSeconds int         `json:"expires_in_seconds"`
-	Token            interface{} `json:"token"`
-	RefreshToken     string      `json:"refresh_token"`
-	IsRed            bool        `json:"is_chirpy_red"`
+	ID             uuid.UUID   `json:"id"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	Email          string      `json:"email"`
+	EmailVerified  bool        `json:"email_verified"`
+	Username       string      `json:"username"`
+	Role           string      `json:"role"`
+	Token          interface{} `json:"token"`
+	RefreshToken   string      `json:"refresh_token"`
+	IsRed          bool        `json:"is_chirpy_red"`
+	FollowerCount  int64       `json:"follower_count"`
+	FollowingCount int64       `json:"following_count"`
+}
+
+// PublicUser is the view of a user shared with everyone. It must never
+// carry private data like the email or the password hash.
+type PublicUser struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Username       string    `json:"username"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	Location       string    `json:"location"`
+	Website        string    `json:"website"`
+	IsRed          bool      `json:"is_chirpy_red"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
 }
 
 type Req struct {
-	Body   string    `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ReplyToID *uuid.UUID `json:"reply_to_id"`
 }
 type Resp struct {
 	CleanedBody string `json:"cleaned_body"`
 }
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+}
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+	IsMutual   bool      `json:"is_mutual"`
+}
+
+type FollowEntry struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+	IsMutual   bool      `json:"is_mutual"`
+}
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"`
+	ActorID   *uuid.UUID `json:"actor_id,omitempty"`
+	ChirpID   *uuid.UUID `json:"chirp_id,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+}
+
+type Conversation struct {
+	ID        uuid.UUID            `json:"id"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Muted     bool                 `json:"muted"`
+	Members   []ConversationMember `json:"members"`
+}
+
+type ConversationMember struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	LastReadAt *time.Time `json:"last_read_at"`
+}
+
+type Message struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+type List struct {
+	ID        uuid.UUID   `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	OwnerID   uuid.UUID   `json:"owner_id"`
+	Name      string      `json:"name"`
+	IsPrivate bool        `json:"is_private"`
+	MemberIDs []uuid.UUID `json:"member_ids,omitempty"`
+}
+
+type Trend struct {
+	Tag   string  `json:"tag"`
+	Count int64   `json:"count"`
+	Score float64 `json:"score"`
+}
+
+type Trends struct {
+	Window     string    `json:"window"`
+	ComputedAt time.Time `json:"computed_at"`
+	Trends     []Trend   `json:"trends"`
+}
+
+type TrendSuppression struct {
+	Term      string     `json:"term"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+}
+
+type Suggestion struct {
+	User               PublicUser `json:"user"`
+	Score              float64    `json:"score"`
+	Reason             string     `json:"reason"`
+	MutualCount        int32      `json:"mutual_count"`
+	SharedHashtagCount int32      `json:"shared_hashtag_count"`
+}
+
+type WebhookEndpoint struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	IsGlobal   bool      `json:"is_global"`
+	Secret     string    `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int32          `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+type OAuthGrant struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+}
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
 }
 
 func stringToUUID(s string) (uuid.UUID, error) {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const usernameChangeCooldown = 30 * 24 * time.Hour
+
+// A username given up stays with its previous owner, redirecting to them,
+// for usernameReleaseGrace before anyone else can claim it.
+const usernameReleaseGrace = 30 * 24 * time.Hour
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,15}$`)
+
+// reservedUsernames can't be claimed by anyone, compared case-insensitively.
+var reservedUsernames = map[string]struct{}{
+	"admin":         {},
+	"administrator": {},
+	"api":           {},
+	"app":           {},
+	"chirpy":        {},
+	"help":          {},
+	"moderator":     {},
+	"root":          {},
+	"security":      {},
+	"support":       {},
+	"system":        {},
+}
+
+var errUsernameTaken = errors.New("Username already taken.")
+
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("Usernames must be 3 to 15 letters, digits or underscores")
+	}
+	lower := strings.ToLower(username)
+	if _, ok := reservedUsernames[lower]; ok {
+		return fmt.Errorf("Username is reserved")
+	}
+	if strings.HasPrefix(lower, "user_") {
+		return fmt.Errorf("Username is reserved")
+	}
+	return nil
+}
+
+// generatedUsername returns the username given to accounts that didn't pick
+// one. The user_ prefix is reserved so they never clash with chosen ones.
+func generatedUsername() string {
+	return "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:10]
+}
+
+// parseHandle strips the optional @ in front of a handle.
+func parseHandle(handle string) string {
+	return strings.TrimPrefix(handle, "@")
+}
+
+// userByHandle returns the user currently owning handle. When handle was
+// given up by a user, that user is returned with redirected set to true.
+func (cfg *apiConfig) userByHandle(ctx context.Context, handle string) (user database.User, redirected bool, err error) {
+	user, err = cfg.db.GetUserByUsername(ctx, handle)
+	if err == nil {
+		return user, false, nil
+	}
+	user, err = cfg.db.GetUserByPreviousUsername(ctx, handle)
+	return user, err == nil, err
+}
+
+// claimUsername frees username for userID, who is uuid.Nil for new users,
+// ending the redirect of its previous owner. It gives errUsernameTaken while
+// the username is still within its release grace period.
+func claimUsername(ctx context.Context, db *database.Queries, username string, userID uuid.UUID) error {
+	reserved, err := db.IsUsernameReserved(ctx, database.IsUsernameReservedParams{
+		Username:      username,
+		UserID:        userID,
+		ReleasedAfter: time.Now().UTC().Add(-usernameReleaseGrace),
+	})
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return errUsernameTaken
+	}
+	return db.DeleteUsernameHistory(ctx, username)
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+type userSet map[uuid.UUID]struct{}
+
+func (s userSet) has(id uuid.UUID) bool {
+	_, ok := s[id]
+	return ok
+}
+
+// viewer returns the user making r, or uuid.Nil when r is anonymous.
+func (cfg *apiConfig) viewer(r *http.Request) (uuid.UUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, nil
+	}
+	return cfg.authenticate(r)
+}
+
+// hiddenUsers returns the users whose content must not be shown to viewer:
+// everyone blocking or blocked by viewer, plus everyone viewer muted.
+func (cfg *apiConfig) hiddenUsers(ctx context.Context, viewer uuid.UUID) (userSet, error) {
+	hidden := userSet{}
+	if viewer == uuid.Nil {
+		return hidden, nil
+	}
+
+	ids, err := cfg.db.GetHiddenUserIDs(ctx, viewer)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hidden[id] = struct{}{}
+	}
+	return hidden, nil
+}
+
+func (cfg *apiConfig) isBlocked(ctx context.Context, userID, otherID uuid.UUID) (bool, error) {
+	return cfg.db.IsBlockedEitherWay(ctx, database.IsBlockedEitherWayParams{
+		UserID:  userID,
+		OtherID: otherID,
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/MeMetoCoco3/goserver/internal/database"
+	"github.com/MeMetoCoco3/goserver/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const webhookPollInterval = 5 * time.Second
+const webhookBatchSize = 20
+const webhookTimeout = 10 * time.Second
+const maxWebhookEndpoints = 10
+
+const (
+	webhookChirpCreated = "chirp.created"
+	webhookChirpDeleted = "chirp.deleted"
+	webhookUserUpgraded = "user.upgraded"
+)
+
+var webhookEventTypes = map[string]struct{}{
+	webhookChirpCreated: {},
+	webhookChirpDeleted: {},
+	webhookUserUpgraded: {},
+}
+
+const (
+	deliveryPending   = "pending"
+	deliverySucceeded = "succeeded"
+	deliveryDead      = "dead"
+)
+
+// webhookPayload is the body of every outgoing webhook. ID is shared by the
+// deliveries of the same event to different endpoints.
+type webhookPayload struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// webhookDispatcher sends queued deliveries. Deliveries are claimed with a
+// lease in the database, so several instances can run dispatchers at once.
+// Its client refuses internal addresses unless allowPrivate is set.
+type webhookDispatcher struct {
+	db     *database.Queries
+	client *http.Client
+}
+
+func newWebhookDispatcher(db *database.Queries, allowPrivate bool) *webhookDispatcher {
+	return &webhookDispatcher{
+		db:     db,
+		client: webhook.NewClient(webhookTimeout, allowPrivate),
+	}
+}
+
+// Enqueue queues a delivery of event to every endpoint of userID subscribed
+// to it, and to every global endpoint.
+func (d *webhookDispatcher) Enqueue(ctx context.Context, event string, userID uuid.UUID, data any) {
+	payload, err := json.Marshal(webhookPayload{
+		ID:        uuid.New(),
+		Type:      event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err == nil {
+		err = d.db.CreateWebhookDeliveries(ctx, database.CreateWebhookDeliveriesParams{
+			EventType: event,
+			Payload:   string(payload),
+			UserID:    userID,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to queue %s webhooks: %v", event, err)
+	}
+}
+
+func (d *webhookDispatcher) run() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.dispatch(context.Background())
+	}
+}
+
+func (d *webhookDispatcher) dispatch(ctx context.Context) {
+	for {
+		deliveries, err := d.db.ClaimWebhookDeliveries(ctx, webhookBatchSize)
+		if err != nil {
+			log.Printf("Failed to claim webhook deliveries: %v", err)
+			return
+		}
+
+		wg := sync.WaitGroup{}
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery database.WebhookDelivery) {
+				defer wg.Done()
+				if err := d.deliver(ctx, delivery); err != nil {
+					log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+				}
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt at delivery and records its outcome. Failed
+// deliveries are retried with backoff until they run out of attempts.
+func (d *webhookDispatcher) deliver(ctx context.Context, delivery database.WebhookDelivery) error {
+	endpoint, err := d.db.GetWebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return err
+	}
+
+	status, sendErr := webhook.Send(ctx, d.client, webhook.Request{
+		URL:        endpoint.Url,
+		Secret:     endpoint.Secret,
+		Event:      delivery.EventType,
+		DeliveryID: delivery.ID.String(),
+		Body:       []byte(delivery.Payload),
+	})
+
+	attempts := int(delivery.Attempts) + 1
+	params := database.RecordWebhookAttemptParams{
+		ID:             delivery.ID,
+		Status:         deliverySucceeded,
+		NextAttemptAt:  time.Now().UTC(),
+		ResponseStatus: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+	}
+	if sendErr != nil {
+		params.LastError = sendErr.Error()
+		params.Status = deliveryPending
+		params.NextAttemptAt = time.Now().UTC().Add(webhook.Backoff(attempts))
+		if attempts >= webhook.MaxAttempts {
+			params.Status = deliveryDead
+		}
+	}
+	return d.db.RecordWebhookAttempt(ctx, params)
+}